@@ -0,0 +1,92 @@
+package diagnosticsEngine
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// message outcomes attributed to a single sender, recipient or message type
+type MessageCounts struct {
+	Sent      int `json:"sent"`
+	Delivered int `json:"delivered"`
+	Dropped   int `json:"dropped"`
+}
+
+func (mc MessageCounts) record(status bool) MessageCounts {
+	mc.Sent++
+	if status {
+		mc.Delivered++
+	} else {
+		mc.Dropped++
+	}
+	return mc
+}
+
+type IDiagnosticsBreakdown interface {
+	// returns the round's message outcomes keyed by sending agent
+	GetSenderBreakdown() map[uuid.UUID]MessageCounts
+	// returns the round's message outcomes keyed by intended recipient
+	GetRecipientBreakdown() map[uuid.UUID]MessageCounts
+	// returns the round's message outcomes keyed by message type name
+	GetMessageTypeBreakdown() map[string]MessageCounts
+}
+
+// per-key message outcomes, guarded against concurrent senders
+type messageBreakdown struct {
+	lock        sync.Mutex
+	bySender    map[uuid.UUID]MessageCounts
+	byRecipient map[uuid.UUID]MessageCounts
+	byType      map[string]MessageCounts
+}
+
+func createMessageBreakdown() *messageBreakdown {
+	return &messageBreakdown{
+		bySender:    make(map[uuid.UUID]MessageCounts),
+		byRecipient: make(map[uuid.UUID]MessageCounts),
+		byType:      make(map[string]MessageCounts),
+	}
+}
+
+func (mb *messageBreakdown) record(sender, recipient uuid.UUID, messageType string, status bool) {
+	mb.lock.Lock()
+	defer mb.lock.Unlock()
+	mb.bySender[sender] = mb.bySender[sender].record(status)
+	mb.byRecipient[recipient] = mb.byRecipient[recipient].record(status)
+	mb.byType[messageType] = mb.byType[messageType].record(status)
+}
+
+func (mb *messageBreakdown) reset() {
+	mb.lock.Lock()
+	defer mb.lock.Unlock()
+	clear(mb.bySender)
+	clear(mb.byRecipient)
+	clear(mb.byType)
+}
+
+func copyCounts[K comparable](lock *sync.Mutex, counts map[K]MessageCounts) map[K]MessageCounts {
+	lock.Lock()
+	defer lock.Unlock()
+	copied := make(map[K]MessageCounts, len(counts))
+	for key, value := range counts {
+		copied[key] = value
+	}
+	return copied
+}
+
+func (de *DiagnosticsEngine) ReportMessageStatus(sender, recipient uuid.UUID, messageType string, status bool) {
+	de.ReportSendMessageStatus(status)
+	de.breakdown.record(sender, recipient, messageType, status)
+}
+
+func (de *DiagnosticsEngine) GetSenderBreakdown() map[uuid.UUID]MessageCounts {
+	return copyCounts(&de.breakdown.lock, de.breakdown.bySender)
+}
+
+func (de *DiagnosticsEngine) GetRecipientBreakdown() map[uuid.UUID]MessageCounts {
+	return copyCounts(&de.breakdown.lock, de.breakdown.byRecipient)
+}
+
+func (de *DiagnosticsEngine) GetMessageTypeBreakdown() map[string]MessageCounts {
+	return copyCounts(&de.breakdown.lock, de.breakdown.byType)
+}
@@ -1,5 +1,24 @@
 package diagnosticsEngine
 
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// effect of a simulated unreliable network on a message
+type NetworkEffect int
+
+const (
+	NetworkLoss NetworkEffect = iota
+	NetworkDuplication
+	NetworkReordering
+	NetworkDelay
+	numNetworkEffects
+)
+
 type IDiagnosticsData interface {
 	GetNumberSentMessages() int
 	GetNumberMessageSuccesses() int
@@ -7,76 +26,157 @@ type IDiagnosticsData interface {
 	GetNumberMessageDrops() int
 	GetMessagingSuccessRate() float32
 	GetEndMessagingSuccessRate(int) float32
+	GetNumberRequestTimeouts() int
+	GetNumberInboxOverflows() int
+	GetNumberNetworkEffects(NetworkEffect) int
+	// time from sending to delivery of messages
+	GetDeliveryLatencies() HistogramSnapshot
+	// time spent in message handlers, overall and per handling agent
+	GetHandlerDurations() HistogramSnapshot
+	GetAgentHandlerDurations() map[uuid.UUID]HistogramSnapshot
+	// time from the start of the turn until agents signalled messaging complete, overall and per agent
+	GetMessagingCompleteTimes() HistogramSnapshot
+	GetAgentMessagingCompleteTimes() map[uuid.UUID]time.Duration
+	// the same distributions accumulated over the engine's lifetime, never reset
+	GetTotalDeliveryLatencies() HistogramSnapshot
+	GetTotalHandlerDurations() HistogramSnapshot
+	GetTotalMessagingCompleteTimes() HistogramSnapshot
 }
 
 type IDiagnosticsEngine interface {
 	// allow agents to report status of sent message
 	ReportSendMessageStatus(bool)
+	// allow agents to report status of sent message, attributed to its sender, recipient and type
+	ReportMessageStatus(uuid.UUID, uuid.UUID, string, bool)
 	// allow server to report number of end message closures
 	ReportEndMessagingStatus(int)
+	// allow agents to report requests which received no reply in time
+	ReportRequestTimeout()
+	// allow server to report messages dropped because an agent's inbox was full
+	ReportInboxOverflow()
+	// allow server to report messages affected by the simulated network
+	ReportNetworkEffect(NetworkEffect)
+	// allow server to report how long a message took to reach its recipient
+	ReportDeliveryLatency(time.Duration)
+	// allow server and agents to report how long an agent took to handle a message
+	ReportHandlerDuration(uuid.UUID, time.Duration)
+	// allow server to report how far into the turn an agent signalled messaging complete
+	ReportMessagingCompleteTime(uuid.UUID, time.Duration)
 	// allow for resetting of diagnostics for round-to-round data
 	ResetRoundDiagnostics()
+	// allow server to archive the round's data in the history before it is reset
+	RecordRoundDiagnostics(int, int)
+	// allow server to discard the history at the start of a fresh run
+	ClearHistory()
+	// allow server to reinstate the history of a run restored from a snapshot
+	RestoreHistory([]TurnRecord)
 	// compile results for end of round messaging status
 	IDiagnosticsData
+	// query and export the archived round data
+	IDiagnosticsHistory
+	// break down round data by agent and message type
+	IDiagnosticsBreakdown
 }
 
+// safe for concurrent use: counters are atomic, and the history and breakdown are guarded by locks
 type DiagnosticsEngine struct {
-	numEndMessagings    int
-	numMessages         int
-	numMessageSuccesses int
+	numEndMessagings    atomic.Int64
+	numMessageSuccesses atomic.Int64
+	numMessageDrops     atomic.Int64
+	numRequestTimeouts  atomic.Int64
+	numInboxOverflows   atomic.Int64
+	numNetworkEffects   [numNetworkEffects]atomic.Int64
+	historyLock         sync.RWMutex
+	history             []TurnRecord
+	breakdown           *messageBreakdown
+	timings             *roundTimings
 }
 
 func (de *DiagnosticsEngine) ReportSendMessageStatus(status bool) {
-	de.numMessages++
 	if status {
-		de.numMessageSuccesses++
+		de.numMessageSuccesses.Add(1)
+	} else {
+		de.numMessageDrops.Add(1)
 	}
 }
 
 func (de *DiagnosticsEngine) ReportEndMessagingStatus(n int) {
-	de.numEndMessagings = n
+	de.numEndMessagings.Store(int64(n))
+}
+
+func (de *DiagnosticsEngine) ReportRequestTimeout() {
+	de.numRequestTimeouts.Add(1)
+}
+
+func (de *DiagnosticsEngine) ReportInboxOverflow() {
+	de.numInboxOverflows.Add(1)
+}
+
+func (de *DiagnosticsEngine) ReportNetworkEffect(effect NetworkEffect) {
+	de.numNetworkEffects[effect].Add(1)
 }
 
 func (de *DiagnosticsEngine) ResetRoundDiagnostics() {
-	de.numEndMessagings = 0
-	de.numMessages = 0
-	de.numMessageSuccesses = 0
+	de.numEndMessagings.Store(0)
+	de.numMessageSuccesses.Store(0)
+	de.numMessageDrops.Store(0)
+	de.numRequestTimeouts.Store(0)
+	de.numInboxOverflows.Store(0)
+	for effect := range de.numNetworkEffects {
+		de.numNetworkEffects[effect].Store(0)
+	}
+	de.breakdown.reset()
+	de.timings.reset()
 }
 
 func CreateDiagnosticsEngine() *DiagnosticsEngine {
 	return &DiagnosticsEngine{
-		numEndMessagings:    0,
-		numMessages:         0,
-		numMessageSuccesses: 0,
+		history:   []TurnRecord{},
+		breakdown: createMessageBreakdown(),
+		timings:   createRoundTimings(),
 	}
 }
 
 func (de *DiagnosticsEngine) GetNumberSentMessages() int {
-	return de.numMessages
+	return de.GetNumberMessageSuccesses() + de.GetNumberMessageDrops()
 }
 
 func (de *DiagnosticsEngine) GetNumberMessageSuccesses() int {
-	return de.numMessageSuccesses
+	return int(de.numMessageSuccesses.Load())
 }
 
 func (de *DiagnosticsEngine) GetNumberEndMessagings() int {
-	return de.numEndMessagings
+	return int(de.numEndMessagings.Load())
 }
 
 func (de *DiagnosticsEngine) GetNumberMessageDrops() int {
-	return de.numMessages - de.numMessageSuccesses
+	return int(de.numMessageDrops.Load())
+}
+
+func (de *DiagnosticsEngine) GetNumberRequestTimeouts() int {
+	return int(de.numRequestTimeouts.Load())
+}
+
+func (de *DiagnosticsEngine) GetNumberInboxOverflows() int {
+	return int(de.numInboxOverflows.Load())
+}
+
+func (de *DiagnosticsEngine) GetNumberNetworkEffects(effect NetworkEffect) int {
+	return int(de.numNetworkEffects[effect].Load())
 }
 
 func (de *DiagnosticsEngine) GetMessagingSuccessRate() float32 {
-	if de.numMessages == 0 {
+	successes := de.GetNumberMessageSuccesses()
+	sent := successes + de.GetNumberMessageDrops()
+	if sent == 0 {
 		return 100
 	}
-	return 100 * float32(de.numMessageSuccesses) / float32(de.numMessages)
+	return 100 * float32(successes) / float32(sent)
 }
 
 func (de *DiagnosticsEngine) GetEndMessagingSuccessRate(numAgents int) float32 {
 	if numAgents == 0 {
 		return 100
 	}
-	return 100 * float32(de.numEndMessagings) / float32(numAgents)
+	return 100 * float32(de.GetNumberEndMessagings()) / float32(numAgents)
 }
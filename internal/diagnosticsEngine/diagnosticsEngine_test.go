@@ -1,9 +1,14 @@
 package diagnosticsEngine_test
 
 import (
+	"bytes"
+	"encoding/json"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/MattSScott/basePlatformSOMAS/v2/internal/diagnosticsEngine"
+	"github.com/google/uuid"
 )
 
 func TestGetNumberSentMessages(t *testing.T) {
@@ -122,6 +127,57 @@ func TestResetDiagnostics(t *testing.T) {
 	}
 }
 
+func TestGetNumberRequestTimeouts(t *testing.T) {
+	engine := diagnosticsEngine.CreateDiagnosticsEngine()
+	if engine.GetNumberRequestTimeouts() != 0 {
+		t.Error("Diagnostics engine intialised with non-zero number")
+	}
+	engine.ReportRequestTimeout()
+	engine.ReportRequestTimeout()
+	if engine.GetNumberRequestTimeouts() != 2 {
+		t.Error("Diagnostics engine request timeouts not correctly incremented")
+	}
+	engine.ResetRoundDiagnostics()
+	if engine.GetNumberRequestTimeouts() != 0 {
+		t.Error("Diagnostic engine request timeouts not reset at end of round")
+	}
+}
+
+func TestGetNumberInboxOverflows(t *testing.T) {
+	engine := diagnosticsEngine.CreateDiagnosticsEngine()
+	if engine.GetNumberInboxOverflows() != 0 {
+		t.Error("Diagnostics engine intialised with non-zero number")
+	}
+	engine.ReportInboxOverflow()
+	if engine.GetNumberInboxOverflows() != 1 {
+		t.Error("Diagnostics engine inbox overflows not correctly incremented")
+	}
+	engine.ResetRoundDiagnostics()
+	if engine.GetNumberInboxOverflows() != 0 {
+		t.Error("Diagnostic engine inbox overflows not reset at end of round")
+	}
+}
+
+func TestGetNumberNetworkEffects(t *testing.T) {
+	engine := diagnosticsEngine.CreateDiagnosticsEngine()
+	engine.ReportNetworkEffect(diagnosticsEngine.NetworkLoss)
+	engine.ReportNetworkEffect(diagnosticsEngine.NetworkLoss)
+	engine.ReportNetworkEffect(diagnosticsEngine.NetworkDelay)
+	if engine.GetNumberNetworkEffects(diagnosticsEngine.NetworkLoss) != 2 {
+		t.Error("Diagnostics engine network losses not correctly incremented")
+	}
+	if engine.GetNumberNetworkEffects(diagnosticsEngine.NetworkDelay) != 1 {
+		t.Error("Diagnostics engine network delays not correctly incremented")
+	}
+	if engine.GetNumberNetworkEffects(diagnosticsEngine.NetworkDuplication) != 0 {
+		t.Error("Diagnostics engine incremented unreported network effect")
+	}
+	engine.ResetRoundDiagnostics()
+	if engine.GetNumberNetworkEffects(diagnosticsEngine.NetworkLoss) != 0 {
+		t.Error("Diagnostic engine network effects not reset at end of round")
+	}
+}
+
 func TestDivideByZeroProtection(t *testing.T) {
 	engine := diagnosticsEngine.CreateDiagnosticsEngine()
 	msgSuccessRate := engine.GetMessagingSuccessRate()
@@ -133,3 +189,176 @@ func TestDivideByZeroProtection(t *testing.T) {
 		t.Errorf("Diagnostic Engine incorrectly reported Finished Messaging Success rate when 0 agents are present. Expected 100%%, got %v%%", endMsgingSuccessRate)
 	}
 }
+
+func recordTestHistory(engine *diagnosticsEngine.DiagnosticsEngine) {
+	// iteration 0: 2 turns, with 1 and 3 drops; iteration 1: 1 turn without drops
+	dropsPerTurn := [][]int{{1, 3}, {0}}
+	for iteration, turns := range dropsPerTurn {
+		for turn, drops := range turns {
+			for i := 0; i < 4; i++ {
+				engine.ReportSendMessageStatus(i >= drops)
+			}
+			engine.ReportEndMessagingStatus(2)
+			engine.RecordRoundDiagnostics(iteration, turn)
+			engine.ResetRoundDiagnostics()
+		}
+	}
+}
+
+func TestDiagnosticsHistory(t *testing.T) {
+	engine := diagnosticsEngine.CreateDiagnosticsEngine()
+	recordTestHistory(engine)
+	history := engine.GetHistory()
+	if len(history) != 3 {
+		t.Fatalf("Expected 3 turns in history, got %d", len(history))
+	}
+	expected := diagnosticsEngine.TurnRecord{Iteration: 0, Turn: 1, Sent: 4, Delivered: 1, Dropped: 3, EndMessagings: 2}
+	if history[1] != expected {
+		t.Errorf("Expected %v, got %v", expected, history[1])
+	}
+	if len(engine.GetIterationHistory(0)) != 2 || len(engine.GetIterationHistory(1)) != 1 {
+		t.Error("History not correctly grouped by iteration")
+	}
+	summary := engine.GetHistorySummary()
+	if summary.Turns != 3 || summary.TotalSent != 12 || summary.TotalDropped != 4 || summary.TotalDelivered != 8 {
+		t.Errorf("Incorrect totals in summary: %+v", summary)
+	}
+	if summary.MeanEndMessagings != 2 || summary.MeanSent != 4 {
+		t.Errorf("Incorrect means in summary: %+v", summary)
+	}
+	if summary.WorstTurn != expected {
+		t.Errorf("Expected worst turn %v, got %v", expected, summary.WorstTurn)
+	}
+	engine.ClearHistory()
+	if len(engine.GetHistory()) != 0 || engine.GetHistorySummary().Turns != 0 {
+		t.Error("History not cleared")
+	}
+}
+
+func TestDiagnosticsHistoryExport(t *testing.T) {
+	engine := diagnosticsEngine.CreateDiagnosticsEngine()
+	recordTestHistory(engine)
+	var csvOutput bytes.Buffer
+	if err := engine.ExportHistoryCSV(&csvOutput); err != nil {
+		t.Fatal(err)
+	}
+	expectedCSV := "iteration,turn,sent,delivered,dropped,endMessagings\n0,0,4,3,1,2\n0,1,4,1,3,2\n1,0,4,4,0,2\n"
+	if csvOutput.String() != expectedCSV {
+		t.Errorf("Unexpected CSV export:\n%s", csvOutput.String())
+	}
+	var jsonOutput bytes.Buffer
+	if err := engine.ExportHistoryJSON(&jsonOutput); err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Turns   []diagnosticsEngine.TurnRecord
+		Summary diagnosticsEngine.HistorySummary
+	}
+	if err := json.Unmarshal(jsonOutput.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Turns) != 3 || decoded.Summary.TotalDropped != 4 {
+		t.Errorf("Unexpected JSON export: %s", jsonOutput.String())
+	}
+}
+
+func TestMessageBreakdown(t *testing.T) {
+	engine := diagnosticsEngine.CreateDiagnosticsEngine()
+	sender, recipient1, recipient2 := uuid.New(), uuid.New(), uuid.New()
+	engine.ReportMessageStatus(sender, recipient1, "proposal", true)
+	engine.ReportMessageStatus(sender, recipient2, "proposal", false)
+	engine.ReportMessageStatus(recipient1, recipient2, "vote", true)
+	if engine.GetNumberSentMessages() != 3 || engine.GetNumberMessageDrops() != 1 {
+		t.Error("Attributed messages not included in global counts")
+	}
+	expectedSender := diagnosticsEngine.MessageCounts{Sent: 2, Delivered: 1, Dropped: 1}
+	if counts := engine.GetSenderBreakdown()[sender]; counts != expectedSender {
+		t.Errorf("Expected sender counts %v, got %v", expectedSender, counts)
+	}
+	expectedRecipient := diagnosticsEngine.MessageCounts{Sent: 2, Delivered: 1, Dropped: 1}
+	if counts := engine.GetRecipientBreakdown()[recipient2]; counts != expectedRecipient {
+		t.Errorf("Expected recipient counts %v, got %v", expectedRecipient, counts)
+	}
+	expectedType := diagnosticsEngine.MessageCounts{Sent: 1, Delivered: 1, Dropped: 0}
+	if counts := engine.GetMessageTypeBreakdown()["vote"]; counts != expectedType {
+		t.Errorf("Expected message type counts %v, got %v", expectedType, counts)
+	}
+	engine.ResetRoundDiagnostics()
+	if len(engine.GetSenderBreakdown()) != 0 || len(engine.GetMessageTypeBreakdown()) != 0 {
+		t.Error("Diagnostic engine breakdown not reset at end of round")
+	}
+}
+
+func TestConcurrentReporting(t *testing.T) {
+	engine := diagnosticsEngine.CreateDiagnosticsEngine()
+	numSenders := 5000
+	reportsPerSender := 10
+	recipient := uuid.New()
+	var wg sync.WaitGroup
+	for i := 0; i < numSenders; i++ {
+		wg.Add(1)
+		go func(status bool) {
+			defer wg.Done()
+			sender := uuid.New()
+			for j := 0; j < reportsPerSender; j++ {
+				engine.ReportMessageStatus(sender, recipient, "stress", status)
+				engine.ReportRequestTimeout()
+				engine.ReportInboxOverflow()
+				engine.ReportNetworkEffect(diagnosticsEngine.NetworkDelay)
+				engine.GetMessagingSuccessRate()
+			}
+		}(i%2 == 0)
+	}
+	wg.Wait()
+	total := numSenders * reportsPerSender
+	if engine.GetNumberSentMessages() != total {
+		t.Errorf("Expected %d sent messages, got %d", total, engine.GetNumberSentMessages())
+	}
+	if engine.GetNumberMessageSuccesses() != total/2 || engine.GetNumberMessageDrops() != total/2 {
+		t.Errorf("Expected %d successes and drops, got %d and %d", total/2, engine.GetNumberMessageSuccesses(), engine.GetNumberMessageDrops())
+	}
+	if engine.GetNumberRequestTimeouts() != total || engine.GetNumberInboxOverflows() != total {
+		t.Error("Concurrent request timeouts or inbox overflows lost")
+	}
+	if engine.GetNumberNetworkEffects(diagnosticsEngine.NetworkDelay) != total {
+		t.Error("Concurrent network effects lost")
+	}
+	if len(engine.GetSenderBreakdown()) != numSenders || engine.GetRecipientBreakdown()[recipient].Sent != total {
+		t.Error("Concurrent breakdown reports lost")
+	}
+}
+
+func TestDurationHistograms(t *testing.T) {
+	engine := diagnosticsEngine.CreateDiagnosticsEngine()
+	slowAgent, fastAgent := uuid.New(), uuid.New()
+	for _, d := range []time.Duration{time.Microsecond, 2 * time.Millisecond, 3 * time.Millisecond, time.Minute} {
+		engine.ReportDeliveryLatency(d)
+	}
+	latencies := engine.GetDeliveryLatencies()
+	if latencies.Count != 4 || latencies.Min != time.Microsecond || latencies.Max != time.Minute {
+		t.Errorf("Unexpected latency histogram: %+v", latencies)
+	}
+	if latencies.Counts[0] != 1 || latencies.Counts[len(latencies.Counts)-1] != 1 {
+		t.Errorf("Latencies not placed in boundary buckets: %v", latencies.Counts)
+	}
+	if latencies.Quantile(0.5) != 5*time.Millisecond || latencies.Quantile(1) != time.Minute {
+		t.Errorf("Unexpected quantiles %v and %v", latencies.Quantile(0.5), latencies.Quantile(1))
+	}
+	engine.ReportHandlerDuration(slowAgent, time.Second)
+	engine.ReportHandlerDuration(fastAgent, time.Millisecond)
+	engine.ReportHandlerDuration(fastAgent, 3*time.Millisecond)
+	if mean := engine.GetAgentHandlerDurations()[fastAgent].Mean(); mean != 2*time.Millisecond {
+		t.Errorf("Expected mean handler duration of 2ms, got %v", mean)
+	}
+	if engine.GetHandlerDurations().Count != 3 {
+		t.Error("Handler durations not included in overall histogram")
+	}
+	engine.ReportMessagingCompleteTime(slowAgent, 40*time.Millisecond)
+	if engine.GetAgentMessagingCompleteTimes()[slowAgent] != 40*time.Millisecond || engine.GetMessagingCompleteTimes().Count != 1 {
+		t.Error("Messaging complete time not recorded")
+	}
+	engine.ResetRoundDiagnostics()
+	if engine.GetDeliveryLatencies().Count != 0 || len(engine.GetAgentHandlerDurations()) != 0 || len(engine.GetAgentMessagingCompleteTimes()) != 0 {
+		t.Error("Diagnostic engine timings not reset at end of round")
+	}
+}
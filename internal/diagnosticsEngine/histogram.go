@@ -0,0 +1,220 @@
+package diagnosticsEngine
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// upper bounds of the histogram buckets, with a final unbounded bucket for longer durations
+var DefaultDurationBuckets = []time.Duration{
+	10 * time.Microsecond,
+	50 * time.Microsecond,
+	100 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// point-in-time copy of a duration histogram
+type HistogramSnapshot struct {
+	// upper bound of each bucket except the last, which is unbounded
+	Bounds []time.Duration `json:"bounds"`
+	// number of observations in each bucket (one more entry than Bounds)
+	Counts []int         `json:"counts"`
+	Count  int           `json:"count"`
+	Sum    time.Duration `json:"sum"`
+	Min    time.Duration `json:"min"`
+	Max    time.Duration `json:"max"`
+}
+
+func (hs HistogramSnapshot) Mean() time.Duration {
+	if hs.Count == 0 {
+		return 0
+	}
+	return hs.Sum / time.Duration(hs.Count)
+}
+
+// returns the upper bound of the bucket containing the q-th quantile (Max if in the unbounded bucket)
+func (hs HistogramSnapshot) Quantile(q float64) time.Duration {
+	if hs.Count == 0 {
+		return 0
+	}
+	rank := int(q * float64(hs.Count))
+	if rank >= hs.Count {
+		rank = hs.Count - 1
+	}
+	seen := 0
+	for i, count := range hs.Counts {
+		seen += count
+		if seen > rank {
+			if i < len(hs.Bounds) {
+				return min(hs.Bounds[i], hs.Max)
+			}
+			return hs.Max
+		}
+	}
+	return hs.Max
+}
+
+// distribution of observed durations, safe for concurrent use
+type durationHistogram struct {
+	lock     sync.Mutex
+	snapshot HistogramSnapshot
+}
+
+func createDurationHistogram() *durationHistogram {
+	return &durationHistogram{snapshot: emptyHistogram()}
+}
+
+func emptyHistogram() HistogramSnapshot {
+	return HistogramSnapshot{
+		Bounds: DefaultDurationBuckets,
+		Counts: make([]int, len(DefaultDurationBuckets)+1),
+	}
+}
+
+func (dh *durationHistogram) observe(d time.Duration) {
+	dh.lock.Lock()
+	defer dh.lock.Unlock()
+	bucket := sort.Search(len(dh.snapshot.Bounds), func(i int) bool {
+		return d <= dh.snapshot.Bounds[i]
+	})
+	dh.snapshot.Counts[bucket]++
+	if dh.snapshot.Count == 0 || d < dh.snapshot.Min {
+		dh.snapshot.Min = d
+	}
+	if d > dh.snapshot.Max {
+		dh.snapshot.Max = d
+	}
+	dh.snapshot.Count++
+	dh.snapshot.Sum += d
+}
+
+func (dh *durationHistogram) read() HistogramSnapshot {
+	dh.lock.Lock()
+	defer dh.lock.Unlock()
+	snapshot := dh.snapshot
+	snapshot.Counts = append([]int{}, dh.snapshot.Counts...)
+	return snapshot
+}
+
+func (dh *durationHistogram) reset() {
+	dh.lock.Lock()
+	defer dh.lock.Unlock()
+	dh.snapshot = emptyHistogram()
+}
+
+// timing data of a round, overall and per agent, with lifetime totals which are never reset
+type roundTimings struct {
+	deliveryLatency     *durationHistogram
+	handlerDuration     *durationHistogram
+	messagingComplete   *durationHistogram
+	totalLatency        *durationHistogram
+	totalHandler        *durationHistogram
+	totalComplete       *durationHistogram
+	agentLock           sync.Mutex
+	agentHandlers       map[uuid.UUID]*durationHistogram
+	agentCompletionTime map[uuid.UUID]time.Duration
+}
+
+func createRoundTimings() *roundTimings {
+	return &roundTimings{
+		deliveryLatency:     createDurationHistogram(),
+		handlerDuration:     createDurationHistogram(),
+		messagingComplete:   createDurationHistogram(),
+		totalLatency:        createDurationHistogram(),
+		totalHandler:        createDurationHistogram(),
+		totalComplete:       createDurationHistogram(),
+		agentHandlers:       make(map[uuid.UUID]*durationHistogram),
+		agentCompletionTime: make(map[uuid.UUID]time.Duration),
+	}
+}
+
+func (rt *roundTimings) reset() {
+	rt.deliveryLatency.reset()
+	rt.handlerDuration.reset()
+	rt.messagingComplete.reset()
+	rt.agentLock.Lock()
+	defer rt.agentLock.Unlock()
+	clear(rt.agentHandlers)
+	clear(rt.agentCompletionTime)
+}
+
+func (de *DiagnosticsEngine) ReportDeliveryLatency(latency time.Duration) {
+	de.timings.deliveryLatency.observe(latency)
+	de.timings.totalLatency.observe(latency)
+}
+
+func (de *DiagnosticsEngine) ReportHandlerDuration(agentID uuid.UUID, duration time.Duration) {
+	de.timings.handlerDuration.observe(duration)
+	de.timings.totalHandler.observe(duration)
+	de.timings.agentLock.Lock()
+	histogram, ok := de.timings.agentHandlers[agentID]
+	if !ok {
+		histogram = createDurationHistogram()
+		de.timings.agentHandlers[agentID] = histogram
+	}
+	de.timings.agentLock.Unlock()
+	histogram.observe(duration)
+}
+
+func (de *DiagnosticsEngine) ReportMessagingCompleteTime(agentID uuid.UUID, elapsed time.Duration) {
+	de.timings.messagingComplete.observe(elapsed)
+	de.timings.totalComplete.observe(elapsed)
+	de.timings.agentLock.Lock()
+	defer de.timings.agentLock.Unlock()
+	de.timings.agentCompletionTime[agentID] = elapsed
+}
+
+func (de *DiagnosticsEngine) GetDeliveryLatencies() HistogramSnapshot {
+	return de.timings.deliveryLatency.read()
+}
+
+func (de *DiagnosticsEngine) GetHandlerDurations() HistogramSnapshot {
+	return de.timings.handlerDuration.read()
+}
+
+func (de *DiagnosticsEngine) GetMessagingCompleteTimes() HistogramSnapshot {
+	return de.timings.messagingComplete.read()
+}
+
+func (de *DiagnosticsEngine) GetTotalDeliveryLatencies() HistogramSnapshot {
+	return de.timings.totalLatency.read()
+}
+
+func (de *DiagnosticsEngine) GetTotalHandlerDurations() HistogramSnapshot {
+	return de.timings.totalHandler.read()
+}
+
+func (de *DiagnosticsEngine) GetTotalMessagingCompleteTimes() HistogramSnapshot {
+	return de.timings.totalComplete.read()
+}
+
+func (de *DiagnosticsEngine) GetAgentHandlerDurations() map[uuid.UUID]HistogramSnapshot {
+	de.timings.agentLock.Lock()
+	defer de.timings.agentLock.Unlock()
+	durations := make(map[uuid.UUID]HistogramSnapshot, len(de.timings.agentHandlers))
+	for id, histogram := range de.timings.agentHandlers {
+		durations[id] = histogram.read()
+	}
+	return durations
+}
+
+func (de *DiagnosticsEngine) GetAgentMessagingCompleteTimes() map[uuid.UUID]time.Duration {
+	de.timings.agentLock.Lock()
+	defer de.timings.agentLock.Unlock()
+	times := make(map[uuid.UUID]time.Duration, len(de.timings.agentCompletionTime))
+	for id, elapsed := range de.timings.agentCompletionTime {
+		times[id] = elapsed
+	}
+	return times
+}
@@ -0,0 +1,152 @@
+package diagnosticsEngine
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+// messaging diagnostics of a single turn, archived before the round is reset
+type TurnRecord struct {
+	Iteration     int `json:"iteration"`
+	Turn          int `json:"turn"`
+	Sent          int `json:"sent"`
+	Delivered     int `json:"delivered"`
+	Dropped       int `json:"dropped"`
+	EndMessagings int `json:"endMessagings"`
+}
+
+// aggregates over every turn in the history
+type HistorySummary struct {
+	Turns              int     `json:"turns"`
+	TotalSent          int     `json:"totalSent"`
+	TotalDelivered     int     `json:"totalDelivered"`
+	TotalDropped       int     `json:"totalDropped"`
+	TotalEndMessagings int     `json:"totalEndMessagings"`
+	MeanSent           float64 `json:"meanSent"`
+	MeanDelivered      float64 `json:"meanDelivered"`
+	MeanDropped        float64 `json:"meanDropped"`
+	MeanEndMessagings  float64 `json:"meanEndMessagings"`
+	// turn with the most dropped messages (earliest on a tie)
+	WorstTurn TurnRecord `json:"worstTurn"`
+}
+
+type IDiagnosticsHistory interface {
+	// returns the round's data (not yet archived) stamped with the given iteration and turn
+	GetRoundRecord(int, int) TurnRecord
+	// returns the archived turns, in the order they were recorded
+	GetHistory() []TurnRecord
+	// returns the archived turns of a single iteration
+	GetIterationHistory(int) []TurnRecord
+	// returns totals, means and the worst turn across the history
+	GetHistorySummary() HistorySummary
+	// writes the history as CSV, one row per turn
+	ExportHistoryCSV(io.Writer) error
+	// writes the history and its summary as JSON
+	ExportHistoryJSON(io.Writer) error
+}
+
+var historyCSVHeader = []string{"iteration", "turn", "sent", "delivered", "dropped", "endMessagings"}
+
+func (de *DiagnosticsEngine) GetRoundRecord(iteration, turn int) TurnRecord {
+	delivered := de.GetNumberMessageSuccesses()
+	dropped := de.GetNumberMessageDrops()
+	return TurnRecord{
+		Iteration:     iteration,
+		Turn:          turn,
+		Sent:          delivered + dropped,
+		Delivered:     delivered,
+		Dropped:       dropped,
+		EndMessagings: de.GetNumberEndMessagings(),
+	}
+}
+
+func (de *DiagnosticsEngine) RecordRoundDiagnostics(iteration, turn int) {
+	record := de.GetRoundRecord(iteration, turn)
+	de.historyLock.Lock()
+	defer de.historyLock.Unlock()
+	de.history = append(de.history, record)
+}
+
+func (de *DiagnosticsEngine) ClearHistory() {
+	de.historyLock.Lock()
+	defer de.historyLock.Unlock()
+	de.history = []TurnRecord{}
+}
+
+func (de *DiagnosticsEngine) RestoreHistory(history []TurnRecord) {
+	de.historyLock.Lock()
+	defer de.historyLock.Unlock()
+	de.history = append([]TurnRecord{}, history...)
+}
+
+func (de *DiagnosticsEngine) GetHistory() []TurnRecord {
+	de.historyLock.RLock()
+	defer de.historyLock.RUnlock()
+	return append([]TurnRecord{}, de.history...)
+}
+
+func (de *DiagnosticsEngine) GetIterationHistory(iteration int) []TurnRecord {
+	records := []TurnRecord{}
+	for _, record := range de.GetHistory() {
+		if record.Iteration == iteration {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+func (de *DiagnosticsEngine) GetHistorySummary() HistorySummary {
+	return summarise(de.GetHistory())
+}
+
+func summarise(history []TurnRecord) HistorySummary {
+	summary := HistorySummary{Turns: len(history)}
+	if summary.Turns == 0 {
+		return summary
+	}
+	summary.WorstTurn = history[0]
+	for _, record := range history {
+		summary.TotalSent += record.Sent
+		summary.TotalDelivered += record.Delivered
+		summary.TotalDropped += record.Dropped
+		summary.TotalEndMessagings += record.EndMessagings
+		if record.Dropped > summary.WorstTurn.Dropped {
+			summary.WorstTurn = record
+		}
+	}
+	turns := float64(summary.Turns)
+	summary.MeanSent = float64(summary.TotalSent) / turns
+	summary.MeanDelivered = float64(summary.TotalDelivered) / turns
+	summary.MeanDropped = float64(summary.TotalDropped) / turns
+	summary.MeanEndMessagings = float64(summary.TotalEndMessagings) / turns
+	return summary
+}
+
+func (de *DiagnosticsEngine) ExportHistoryCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(historyCSVHeader); err != nil {
+		return err
+	}
+	for _, record := range de.GetHistory() {
+		row := []int{record.Iteration, record.Turn, record.Sent, record.Delivered, record.Dropped, record.EndMessagings}
+		fields := make([]string, len(row))
+		for i, value := range row {
+			fields[i] = strconv.Itoa(value)
+		}
+		if err := writer.Write(fields); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func (de *DiagnosticsEngine) ExportHistoryJSON(w io.Writer) error {
+	history := de.GetHistory()
+	return json.NewEncoder(w).Encode(struct {
+		Turns   []TurnRecord   `json:"turns"`
+		Summary HistorySummary `json:"summary"`
+	}{history, summarise(history)})
+}
@@ -1,6 +1,7 @@
 package testUtils
 
 import (
+	"encoding/json"
 	"fmt"
 	"sync"
 	"sync/atomic"
@@ -23,6 +24,7 @@ type ITestBaseAgent interface {
 	GetAgentStoppedTalking() int
 	HandleTimeoutTestMessage(msg TestTimeoutMessage)
 	HandleInfiniteLoopMessage(msg TestMessagingBandwidthLimiter)
+	HandleRequestMessage(msg TestRequestMessage)
 }
 
 type TestServerFunctionsAgent struct {
@@ -109,3 +111,84 @@ func (ta *TestServerFunctionsAgent) HandleInfiniteLoopMessage(msg TestMessagingB
 	// msg.SetSender(ta.GetID())
 	ta.SendMessage(&msg, originalSender)
 }
+
+func (ta *TestServerFunctionsAgent) HandleRequestMessage(msg TestRequestMessage) {
+	ta.Reply(&msg, ta.CreateTestMessage())
+}
+
+func (ta *TestServerFunctionsAgent) SnapshotState() ([]byte, error) {
+	return json.Marshal([]int32{ta.Counter, ta.Goal})
+}
+
+func (ta *TestServerFunctionsAgent) RestoreState(state []byte) error {
+	var fields []int32
+	if err := json.Unmarshal(state, &fields); err != nil {
+		return err
+	}
+	if len(fields) != 2 {
+		return fmt.Errorf("expected counter and goal in agent state, got %d fields", len(fields))
+	}
+	ta.Counter, ta.Goal = fields[0], fields[1]
+	return nil
+}
+
+// records the lifecycle hooks invoked on it
+type TestHookAgent struct {
+	*TestServerFunctionsAgent
+	lock  sync.Mutex
+	calls []string
+}
+
+func NewTestHookAgent(serv agent.IExposedServerFunctions[ITestBaseAgent]) *TestHookAgent {
+	return &TestHookAgent{
+		TestServerFunctionsAgent: NewTestAgent(serv).(*TestServerFunctionsAgent),
+	}
+}
+
+func (ha *TestHookAgent) record(call string) {
+	ha.lock.Lock()
+	defer ha.lock.Unlock()
+	ha.calls = append(ha.calls, call)
+}
+
+func (ha *TestHookAgent) Calls() []string {
+	ha.lock.Lock()
+	defer ha.lock.Unlock()
+	return append([]string{}, ha.calls...)
+}
+
+func (ha *TestHookAgent) OnIterationStart(iteration int) {
+	ha.record(fmt.Sprintf("iterationStart %d", iteration))
+}
+
+func (ha *TestHookAgent) OnIterationEnd(iteration int) {
+	ha.record(fmt.Sprintf("iterationEnd %d", iteration))
+}
+
+func (ha *TestHookAgent) OnTurnStart(iteration, turn int) {
+	ha.record(fmt.Sprintf("turnStart %d.%d", iteration, turn))
+}
+
+func (ha *TestHookAgent) OnTurnEnd(iteration, turn int) {
+	ha.record(fmt.Sprintf("turnEnd %d.%d", iteration, turn))
+}
+
+func (ha *TestHookAgent) OnAdded() {
+	ha.record("added")
+}
+
+func (ha *TestHookAgent) OnRemoved() {
+	ha.record("removed")
+}
+
+func (ha *TestHookAgent) Step(iteration, turn int) {
+	ha.record(fmt.Sprintf("step %d.%d", iteration, turn))
+}
+
+func (ha *TestHookAgent) StepStage(stage string, iteration, turn int) {
+	ha.record(fmt.Sprintf("%s %d.%d", stage, iteration, turn))
+}
+
+func (ha *TestHookAgent) Advance(iteration, turn int) {
+	ha.record(fmt.Sprintf("advance %d.%d", iteration, turn))
+}
@@ -53,6 +53,10 @@ type TestMessagingBandwidthLimiter struct {
 	message.BaseMessage
 }
 
+type TestRequestMessage struct {
+	message.BaseMessage
+}
+
 func NewExtendedAgent(serv agent.IExposedServerFunctions[IExtendedAgent]) IExtendedAgent {
 	return &TestMessagingAgent{
 		BaseAgent:  agent.CreateBaseAgent(serv),
@@ -64,6 +68,10 @@ func (infLoopMessage TestMessagingBandwidthLimiter) InvokeMessageHandler(ag ITes
 	ag.HandleInfiniteLoopMessage(infLoopMessage)
 }
 
+func (requestM TestRequestMessage) InvokeMessageHandler(ag ITestBaseAgent) {
+	ag.HandleRequestMessage(requestM)
+}
+
 func (timeoutM TestTimeoutMessage) InvokeMessageHandler(ag ITestBaseAgent) {
 	ag.HandleTimeoutTestMessage(timeoutM)
 }
@@ -1,6 +1,7 @@
 package testUtils
 
 import (
+	"context"
 	"sync"
 	"time"
 
@@ -17,6 +18,16 @@ type TestTurnMethodPanics struct {
 	*server.BaseServer[ITestBaseAgent]
 }
 
+type TestStoppingServer struct {
+	*TestServer
+	StopAfterTurns int
+}
+
+type TestTurnStampServer struct {
+	*TestServer
+	MessageStamps [][2]int
+}
+
 type TestServer struct {
 	*server.BaseServer[ITestBaseAgent]
 	TurnCounter           int
@@ -37,6 +48,20 @@ func GenerateTestServer(numAgents, iterations, turns int, maxDuration time.Durat
 	return serv
 }
 
+func GenerateDeterministicTestServer(seed int64, numAgents, iterations, turns int, maxDuration time.Duration, maxThreads int) *TestServer {
+	serv := &TestServer{
+		BaseServer:            server.CreateBaseServer[ITestBaseAgent](iterations, turns, maxDuration, maxThreads),
+		TurnCounter:           0,
+		IterationStartCounter: 0,
+		IterationEndCounter:   0,
+	}
+	serv.EnableDeterministicMode(seed)
+	for i := 0; i < numAgents; i++ {
+		serv.AddAgent(NewTestAgent(serv))
+	}
+	return serv
+}
+
 func CreateTestTimeoutMessage(workLoad time.Duration) *TestTimeoutMessage {
 	return &TestTimeoutMessage{
 		message.BaseMessage{Sender: uuid.New()},
@@ -80,3 +105,32 @@ func SendNotifyMessages(agMap map[uuid.UUID]ITestBaseAgent, count *uint32, wg *s
 		go ag.SignalMessagingCompleteUnthreaded(wg, count)
 	}
 }
+
+func GenerateTestStoppingServer(numAgents, iterations, turns, stopAfterTurns int, maxDuration time.Duration, maxThreads int) *TestStoppingServer {
+	return &TestStoppingServer{
+		TestServer:     GenerateTestServer(numAgents, iterations, turns, maxDuration, maxThreads),
+		StopAfterTurns: stopAfterTurns,
+	}
+}
+
+func (ts *TestStoppingServer) RunTurnWithContext(ctx context.Context, iteration, turn int) {
+	ts.RunTurn(iteration, turn)
+	if ts.TurnCounter == ts.StopAfterTurns {
+		ts.Stop()
+	}
+}
+
+func GenerateTestTurnStampServer(numAgents, iterations, turns int, maxDuration time.Duration, maxThreads int) *TestTurnStampServer {
+	return &TestTurnStampServer{
+		TestServer:    GenerateTestServer(numAgents, iterations, turns, maxDuration, maxThreads),
+		MessageStamps: [][2]int{},
+	}
+}
+
+func (ts *TestTurnStampServer) RunTurn(iteration, turn int) {
+	for _, ag := range ts.GetAgentMap() {
+		msg := ag.CreateTestMessage()
+		ts.MessageStamps = append(ts.MessageStamps, [2]int{msg.GetIteration(), msg.GetTurn()})
+		break
+	}
+}
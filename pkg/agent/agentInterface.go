@@ -1,7 +1,11 @@
 package agent
 
 import (
+	"context"
+	"time"
+
 	"github.com/MattSScott/basePlatformSOMAS/v2/internal/diagnosticsEngine"
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/events"
 	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/message"
 	"github.com/google/uuid"
 )
@@ -9,16 +13,46 @@ import (
 type IExposedServerFunctions[T any] interface {
 	// return hashset of all agent IDs
 	ViewAgentIdSet() map[uuid.UUID]struct{}
+	// return agent IDs in the order they were added to the server
+	ViewOrderedAgentIds() []uuid.UUID
+	// return the IDs an agent may message (all agents if no topology is set)
+	ViewNeighbours(uuid.UUID) []uuid.UUID
+	// return whether the communication topology allows a sender to message a recipient
+	CanMessage(uuid.UUID, uuid.UUID) bool
 	// return exposed functions for agent
 	AccessAgentByID(uuid.UUID) T
+	// generate a unique ID for a newly created agent
+	GenerateAgentID() uuid.UUID
+	// generate a unique ID for a newly created message
+	GenerateMessageID() uuid.UUID
 	// allows base agent to deliver message
 	DeliverMessage(message.IMessage[T], uuid.UUID)
+	// allows base agent to deliver message asynchronously, calling the callback once handled
+	ScheduleMessageDelivery(message.IMessage[T], uuid.UUID, func())
 	// notify that agent has completed talking phase
 	AgentStoppedTalking(uuid.UUID)
 	// return max number of threads spawnable by an agent
 	GetAgentMessagingBandwidth() int
 	// return diagnostic engine used for tracking message data
 	GetDiagnosticEngine() diagnosticsEngine.IDiagnosticsEngine
+	// return the name under which a message's type is reported in diagnostics
+	GetMessageTypeName(message.IMessage[T]) string
+	// return the iteration in progress (-1 if outside a run)
+	GetCurrentIteration() int
+	// return the turn in progress (-1 if outside a turn)
+	GetCurrentTurn() int
+	// return an agent's inbox of undelivered messages (nil if not in mailbox mode)
+	Inbox(uuid.UUID) <-chan message.IMessage[T]
+	// return the IDs of a group's members, in order of joining
+	ViewGroupMembers(uuid.UUID) []uuid.UUID
+	// add an agent to a group
+	JoinGroup(uuid.UUID, uuid.UUID) error
+	// remove an agent from a group
+	LeaveGroup(uuid.UUID, uuid.UUID) error
+	// record an event in the structured event log
+	EmitEvent(events.Event)
+	// return whether any event sinks are registered
+	HasEventSinks() bool
 }
 
 type IMessagingFunctions[T any] interface {
@@ -32,8 +66,22 @@ type IMessagingFunctions[T any] interface {
 	BroadcastMessage(message.IMessage[T])
 	// allows for sending a sync message across the entire system
 	BroadcastSynchronousMessage(message.IMessage[T])
+	// allows for sending an async message to every other member of a group
+	MulticastMessage(message.IMessage[T], uuid.UUID)
+	// allows for sending an async message to several recipients
+	SendToMany(message.IMessage[T], []uuid.UUID)
 	// signals end of agent's listening session
 	SignalMessagingComplete()
+	// sends a message and returns a channel yielding the reply, closed without a value on timeout
+	Request(message.IMessage[T], uuid.UUID, time.Duration) <-chan message.IMessage[T]
+	// sends a response to the sender of a request
+	Reply(message.IMessage[T], message.IMessage[T])
+	// completes a pending request if the message replies to it, reporting whether it did
+	ResolveReply(message.IMessage[T]) bool
+	// handles every message waiting in the agent's inbox, returning the number handled (0 if not in mailbox mode)
+	ProcessInbox() int
+	// waits for the next message in the agent's inbox, without handling it (ErrMailboxDisabled if not in mailbox mode)
+	Receive(context.Context) (message.IMessage[T], error)
 }
 
 type IAgent[T any] interface {
@@ -44,3 +92,61 @@ type IAgent[T any] interface {
 	// returns the unique ID of an agent
 	GetID() uuid.UUID
 }
+
+// optional interface for agents whose internal state should be kept in server snapshots
+type Snapshotter interface {
+	// serialises the agent's internal state
+	SnapshotState() ([]byte, error)
+	// restores the agent's internal state from the output of SnapshotState
+	RestoreState([]byte) error
+}
+
+// optional interfaces for agents which react to the game loop. The server invokes
+// them automatically for every agent implementing them
+
+type IterationStartHook interface {
+	// called at the start of each iteration, before the game runner's RunStartOfIteration
+	OnIterationStart(iteration int)
+}
+
+type IterationEndHook interface {
+	// called at the end of each iteration, after the game runner's RunEndOfIteration
+	OnIterationEnd(iteration int)
+}
+
+type TurnStartHook interface {
+	// called at the start of each turn, before the game runner's RunTurn. Messages may be sent
+	OnTurnStart(iteration, turn int)
+}
+
+type TurnEndHook interface {
+	// called once each turn's messaging session has ended
+	OnTurnEnd(iteration, turn int)
+}
+
+type AddedHook interface {
+	// called when the agent is added to the server
+	OnAdded()
+}
+
+type RemovedHook interface {
+	// called when the agent is removed from the server
+	OnRemoved()
+}
+
+// optional interfaces for agents activated by a server scheduler
+
+type Stepper interface {
+	// called when the agent is activated during a turn
+	Step(iteration, turn int)
+}
+
+type StagedStepper interface {
+	// called for each stage of a staged scheduler, once every agent has completed the previous stage
+	StepStage(stage string, iteration, turn int)
+}
+
+type Advancer interface {
+	// called by a simultaneous scheduler once every agent has stepped, to apply the changes decided in Step
+	Advance(iteration, turn int)
+}
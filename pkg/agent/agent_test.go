@@ -1,12 +1,16 @@
 package agent_test
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/MattSScott/basePlatformSOMAS/v2/internal/testUtils"
 	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/agent"
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/message"
 	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/server"
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/topology"
 	"github.com/google/uuid"
 )
 
@@ -44,6 +48,26 @@ func TestCreateBaseMessage(t *testing.T) {
 	}
 }
 
+func TestCreateBaseMessageMetadata(t *testing.T) {
+	testServ := testUtils.GenerateTestServer(1, 1, 1, time.Second, 100000)
+	ag := testUtils.NewTestAgent(testServ)
+	before := time.Now()
+	msg1 := ag.CreateBaseMessage()
+	msg2 := ag.CreateBaseMessage()
+	if msg1.GetID() == uuid.Nil || msg1.GetID() == msg2.GetID() {
+		t.Error("Messages not created with unique IDs")
+	}
+	if msg1.GetIteration() != -1 || msg1.GetTurn() != -1 {
+		t.Error("Message created outside run stamped with iteration", msg1.GetIteration(), "turn", msg1.GetTurn())
+	}
+	if msg1.GetSentAt().Before(before) || msg2.GetSentAt().Before(msg1.GetSentAt()) {
+		t.Error("Message timestamps not monotonic")
+	}
+	if msg1.GetInReplyTo() != uuid.Nil || msg1.GetTTL() != 0 || msg1.IsExpired(time.Now().Add(time.Hour)) {
+		t.Error("Message created with reply correlation or expiry")
+	}
+}
+
 func TestNotifyAgentMessaging(t *testing.T) {
 	testServ := testUtils.GenerateTestServer(1, 1, 1, time.Second, 100000)
 	ag := testUtils.NewTestAgent(testServ)
@@ -222,3 +246,181 @@ func TestBroadcastSynchronousMessageDoesPanic(t *testing.T) {
 	}
 	agent1.BroadcastSynchronousMessage(testMessage)
 }
+
+func TestRequestReceivesReply(t *testing.T) {
+	server := testUtils.GenerateTestServer(2, 1, 1, time.Second, 100)
+	ids := server.ViewOrderedAgentIds()
+	requester := server.AccessAgentByID(ids[0])
+	responder := server.AccessAgentByID(ids[1])
+	request := &testUtils.TestRequestMessage{BaseMessage: requester.CreateBaseMessage()}
+	select {
+	case reply, ok := <-requester.Request(request, responder.GetID(), time.Second):
+		if !ok {
+			t.Fatal("Request timed out")
+		}
+		replyMetadata := reply.(message.IMessageMetadata)
+		if replyMetadata.GetInReplyTo() != request.GetID() || reply.GetSender() != responder.GetID() {
+			t.Error("Reply not correlated with request")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Request channel never resolved")
+	}
+	if requester.GetCounter() != 0 {
+		t.Error("Reply was passed to message handler as well as the request")
+	}
+	if server.GetDiagnosticEngine().GetNumberRequestTimeouts() != 0 {
+		t.Error("Answered request reported as timed out")
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	server := testUtils.GenerateTestServer(2, 1, 1, time.Second, 100)
+	ids := server.ViewOrderedAgentIds()
+	requester := server.AccessAgentByID(ids[0])
+	silent := server.AccessAgentByID(ids[1])
+	_, ok := <-requester.Request(requester.CreateTestMessage(), silent.GetID(), 10*time.Millisecond)
+	if ok {
+		t.Error("Request to silent agent produced a reply")
+	}
+	if timeouts := server.GetDiagnosticEngine().GetNumberRequestTimeouts(); timeouts != 1 {
+		t.Error("Expected 1 request timeout, got:", timeouts)
+	}
+}
+
+func TestDroppedRequestResolvesImmediately(t *testing.T) {
+	server := testUtils.GenerateTestServer(2, 1, 1, time.Second, 100)
+	server.SetTopology(topology.CreateGraph())
+	ids := server.ViewOrderedAgentIds()
+	requester := server.AccessAgentByID(ids[0])
+	select {
+	case _, ok := <-requester.Request(requester.CreateTestMessage(), ids[1], time.Minute):
+		if ok {
+			t.Error("Dropped request produced a reply")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Dropped request waited for its timeout")
+	}
+	engine := server.GetDiagnosticEngine()
+	if engine.GetNumberRequestTimeouts() != 0 {
+		t.Error("Dropped request reported as timed out")
+	}
+	if engine.GetNumberMessageDrops() != 1 {
+		t.Error("Expected dropped request to be recorded as a drop, got:", engine.GetNumberMessageDrops())
+	}
+}
+
+func TestRequestNoIDPanic(t *testing.T) {
+	defer func() {
+		if panicValue := recover(); panicValue == nil {
+			t.Errorf("did not panic when request message ID not set")
+		}
+	}()
+	server := testUtils.GenerateTestServer(1, 1, 1, time.Millisecond, 100)
+	ag := server.AccessAgentByID(server.ViewOrderedAgentIds()[0])
+	ag.Request(&testUtils.TestMessage{}, ag.GetID(), time.Millisecond)
+}
+
+func TestReceiveWithoutMailbox(t *testing.T) {
+	server := testUtils.GenerateTestServer(1, 1, 1, time.Second, 100)
+	ag := server.AccessAgentByID(server.ViewOrderedAgentIds()[0])
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := ag.Receive(ctx); !errors.Is(err, agent.ErrMailboxDisabled) {
+		t.Error("Expected ErrMailboxDisabled, got:", err)
+	}
+	if ctx.Err() != nil {
+		t.Error("Receive waited for the context instead of failing immediately")
+	}
+}
+
+func TestMailboxDeliveryDefersHandling(t *testing.T) {
+	server := testUtils.GenerateTestServer(2, 1, 1, time.Second, 100)
+	server.EnableMailboxDelivery(10)
+	ids := server.ViewOrderedAgentIds()
+	sender := server.AccessAgentByID(ids[0])
+	recipient := server.AccessAgentByID(ids[1])
+	for i := 0; i < 3; i++ {
+		sender.SendSynchronousMessage(sender.CreateTestMessage(), recipient.GetID())
+	}
+	if recipient.GetCounter() != 0 {
+		t.Error("Message handled before inbox was processed")
+	}
+	if handled := recipient.ProcessInbox(); handled != 3 {
+		t.Error("Expected 3 messages processed, got:", handled)
+	}
+	if recipient.GetCounter() != 3 {
+		t.Error("Expected 3 messages handled, got:", recipient.GetCounter())
+	}
+	if handled := recipient.ProcessInbox(); handled != 0 {
+		t.Error("Inbox not emptied by processing, got:", handled)
+	}
+}
+
+func TestMailboxReceive(t *testing.T) {
+	server := testUtils.GenerateTestServer(2, 1, 1, time.Second, 100)
+	server.EnableMailboxDelivery(10)
+	ids := server.ViewOrderedAgentIds()
+	sender := server.AccessAgentByID(ids[0])
+	recipient := server.AccessAgentByID(ids[1])
+	sent := sender.CreateTestMessage()
+	sender.SendMessage(sent, recipient.GetID())
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	received, err := recipient.Receive(ctx)
+	if err != nil {
+		t.Fatal("Receive failed:", err)
+	}
+	if received.(message.IMessageMetadata).GetID() != sent.GetID() {
+		t.Error("Received a different message to the one sent")
+	}
+	emptyCtx, emptyCancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer emptyCancel()
+	if _, err := recipient.Receive(emptyCtx); err == nil {
+		t.Error("Receive on empty inbox did not wait for context")
+	}
+}
+
+func TestMulticastMessage(t *testing.T) {
+	server := testUtils.GenerateTestServer(4, 1, 1, time.Second, 100)
+	server.EnableMailboxDelivery(10)
+	ids := server.ViewOrderedAgentIds()
+	groupID, err := server.CreateGroup("council", ids[0], ids[1])
+	if err != nil {
+		t.Fatal("Unable to create group:", err)
+	}
+	if err := server.AccessAgentByID(ids[2]).JoinGroup(groupID, ids[2]); err != nil {
+		t.Fatal("Unable to join group:", err)
+	}
+	sender := server.AccessAgentByID(ids[0])
+	sender.MulticastMessage(sender.CreateTestMessage(), groupID)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	for _, id := range ids[1:3] {
+		if _, err := server.AccessAgentByID(id).Receive(ctx); err != nil {
+			t.Error("Group member did not receive multicast message")
+		}
+	}
+	if server.GetDiagnosticEngine().GetNumberSentMessages() != 2 {
+		t.Error("Expected 2 sends recorded, got:", server.GetDiagnosticEngine().GetNumberSentMessages())
+	}
+	for _, id := range []uuid.UUID{ids[0], ids[3]} {
+		if handled := server.AccessAgentByID(id).ProcessInbox(); handled != 0 {
+			t.Error("Sender or non-member received multicast message")
+		}
+	}
+}
+
+func TestSendToManyRespectsBandwidth(t *testing.T) {
+	bandwidth := 2
+	server := testUtils.GenerateDeterministicTestServer(3, 5, 1, 1, time.Second, bandwidth)
+	ids := server.ViewOrderedAgentIds()
+	sender := server.AccessAgentByID(ids[0])
+	sender.SendToMany(sender.CreateTestMessage(), ids[1:])
+	engine := server.GetDiagnosticEngine()
+	if engine.GetNumberSentMessages() != len(ids)-1 {
+		t.Error("Expected", len(ids)-1, "sends recorded, got:", engine.GetNumberSentMessages())
+	}
+	if engine.GetNumberMessageSuccesses() != bandwidth {
+		t.Error("Expected", bandwidth, "sends within bandwidth, got:", engine.GetNumberMessageSuccesses())
+	}
+}
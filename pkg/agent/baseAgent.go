@@ -1,16 +1,35 @@
 package agent
 
 import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
 	"github.com/MattSScott/basePlatformSOMAS/v2/internal/diagnosticsEngine"
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/events"
 	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/message"
 	"github.com/google/uuid"
 )
 
+// returned by Receive when the server is not in mailbox mode, so agents have no inbox
+var ErrMailboxDisabled = errors.New("mailbox delivery not enabled")
+
 type BaseAgent[T IAgent[T]] struct {
 	IExposedServerFunctions[T]
 	id                      uuid.UUID
 	messageLimiterSemaphore chan struct{}
 	diagnosticsEngine       diagnosticsEngine.IDiagnosticsEngine
+	// requests awaiting a reply, keyed by request message ID
+	pendingRequests map[uuid.UUID]*pendingRequest[T]
+	// guards pending requests against concurrent replies and timeouts
+	pendingRequestsLock sync.Mutex
+}
+
+// a request awaiting a reply
+type pendingRequest[T any] struct {
+	reply   chan message.IMessage[T]
+	timeout *time.Timer
 }
 
 func (a *BaseAgent[T]) GetID() uuid.UUID {
@@ -23,14 +42,21 @@ func CreateBaseAgent[T IAgent[T]](serv IExposedServerFunctions[T]) *BaseAgent[T]
 	}
 	return &BaseAgent[T]{
 		IExposedServerFunctions: serv,
-		id:                      uuid.New(),
+		id:                      serv.GenerateAgentID(),
 		messageLimiterSemaphore: make(chan struct{}, serv.GetAgentMessagingBandwidth()),
 		diagnosticsEngine:       serv.GetDiagnosticEngine(),
+		pendingRequests:         make(map[uuid.UUID]*pendingRequest[T]),
 	}
 }
 
 func (a *BaseAgent[T]) CreateBaseMessage() message.BaseMessage {
-	return message.BaseMessage{Sender: a.GetID()}
+	return message.BaseMessage{
+		Sender:    a.GetID(),
+		ID:        a.GenerateMessageID(),
+		Iteration: a.GetCurrentIteration(),
+		Turn:      a.GetCurrentTurn(),
+		SentAt:    time.Now(),
+	}
 }
 
 func (a *BaseAgent[T]) SignalMessagingComplete() {
@@ -38,26 +64,44 @@ func (a *BaseAgent[T]) SignalMessagingComplete() {
 }
 
 func (a *BaseAgent[T]) SendMessage(msg message.IMessage[T], recipient uuid.UUID) {
+	a.sendMessage(msg, recipient)
+}
+
+// sends a message asynchronously, returning the reason it was dropped ("" if it was sent)
+func (a *BaseAgent[T]) sendMessage(msg message.IMessage[T], recipient uuid.UUID) string {
 	if msg.GetSender() == uuid.Nil {
 		panic("No sender found - did you compose the BaseMessage?")
 	}
-	status := false
+	messageType := a.GetMessageTypeName(msg)
+	if !a.CanMessage(a.id, recipient) {
+		a.diagnosticsEngine.ReportMessageStatus(a.id, recipient, messageType, false)
+		a.emitMessageEvent(events.MessageDropped, msg, recipient, events.DropTopology)
+		return events.DropTopology
+	}
+	dropReason := ""
 	select {
 	case a.messageLimiterSemaphore <- struct{}{}:
-		go func() {
-			a.DeliverMessage(msg, recipient)
+		a.emitMessageEvent(events.MessageSent, msg, recipient, "")
+		a.ScheduleMessageDelivery(msg, recipient, func() {
 			<-a.messageLimiterSemaphore
-		}()
-		status = true
+		})
 	default:
+		dropReason = events.DropBandwidth
+		a.emitMessageEvent(events.MessageDropped, msg, recipient, dropReason)
 	}
-	a.diagnosticsEngine.ReportSendMessageStatus(status)
+	a.diagnosticsEngine.ReportMessageStatus(a.id, recipient, messageType, dropReason == "")
+	return dropReason
 }
 
 func (a *BaseAgent[T]) SendSynchronousMessage(msg message.IMessage[T], recipient uuid.UUID) {
 	if msg.GetSender() == uuid.Nil {
 		panic("No sender found - did you compose the BaseMessage?")
 	}
+	if !a.CanMessage(a.id, recipient) {
+		a.diagnosticsEngine.ReportMessageStatus(a.id, recipient, a.GetMessageTypeName(msg), false)
+		a.emitMessageEvent(events.MessageDropped, msg, recipient, events.DropTopology)
+		return
+	}
 	a.DeliverMessage(msg, recipient)
 }
 
@@ -65,7 +109,19 @@ func (agent *BaseAgent[T]) BroadcastMessage(msg message.IMessage[T]) {
 	if msg.GetSender() == uuid.Nil {
 		panic("No sender found - did you compose the BaseMessage?")
 	}
-	for id := range agent.ViewAgentIdSet() {
+	for _, id := range agent.ViewNeighbours(agent.id) {
+		if id == msg.GetSender() {
+			continue
+		}
+		agent.SendMessage(msg, id)
+	}
+}
+
+func (agent *BaseAgent[T]) MulticastMessage(msg message.IMessage[T], groupID uuid.UUID) {
+	if msg.GetSender() == uuid.Nil {
+		panic("No sender found - did you compose the BaseMessage?")
+	}
+	for _, id := range agent.ViewGroupMembers(groupID) {
 		if id == msg.GetSender() {
 			continue
 		}
@@ -73,14 +129,137 @@ func (agent *BaseAgent[T]) BroadcastMessage(msg message.IMessage[T]) {
 	}
 }
 
+func (agent *BaseAgent[T]) SendToMany(msg message.IMessage[T], recipients []uuid.UUID) {
+	if msg.GetSender() == uuid.Nil {
+		panic("No sender found - did you compose the BaseMessage?")
+	}
+	for _, id := range recipients {
+		agent.SendMessage(msg, id)
+	}
+}
+
 func (agent *BaseAgent[T]) BroadcastSynchronousMessage(msg message.IMessage[T]) {
 	if msg.GetSender() == uuid.Nil {
 		panic("No sender found - did you compose the BaseMessage?")
 	}
-	for id := range agent.ViewAgentIdSet() {
+	for _, id := range agent.ViewNeighbours(agent.id) {
 		if id == msg.GetSender() {
 			continue
 		}
 		agent.SendSynchronousMessage(msg, id)
 	}
 }
+
+func (a *BaseAgent[T]) Request(msg message.IMessage[T], recipient uuid.UUID, timeout time.Duration) <-chan message.IMessage[T] {
+	metadata, ok := msg.(message.IMessageMetadata)
+	if !ok || metadata.GetID() == uuid.Nil {
+		panic("No message ID found - was the message created with CreateBaseMessage?")
+	}
+	requestID := metadata.GetID()
+	request := &pendingRequest[T]{reply: make(chan message.IMessage[T], 1)}
+	a.pendingRequestsLock.Lock()
+	a.pendingRequests[requestID] = request
+	request.timeout = time.AfterFunc(timeout, func() {
+		if a.cancelRequest(requestID) {
+			a.diagnosticsEngine.ReportRequestTimeout()
+			a.emitMessageEvent(events.RequestTimeout, msg, recipient, "")
+		}
+	})
+	a.pendingRequestsLock.Unlock()
+	// a dropped request can never be answered, so it is abandoned without waiting for the timeout
+	// (its drop having been recorded by the send)
+	if dropReason := a.sendMessage(msg, recipient); dropReason != "" {
+		a.cancelRequest(requestID)
+	}
+	return request.reply
+}
+
+// abandons a pending request, closing its reply channel. Reports whether the request was still pending
+func (a *BaseAgent[T]) cancelRequest(requestID uuid.UUID) bool {
+	a.pendingRequestsLock.Lock()
+	defer a.pendingRequestsLock.Unlock()
+	request, pending := a.pendingRequests[requestID]
+	if !pending {
+		return false
+	}
+	delete(a.pendingRequests, requestID)
+	request.timeout.Stop()
+	close(request.reply)
+	return true
+}
+
+func (a *BaseAgent[T]) Reply(original message.IMessage[T], response message.IMessage[T]) {
+	originalMetadata, ok := original.(message.IMessageMetadata)
+	if !ok || originalMetadata.GetID() == uuid.Nil {
+		panic("No message ID found on original - was it created with CreateBaseMessage?")
+	}
+	responseMetadata, ok := response.(message.IMessageMetadata)
+	if !ok {
+		panic("Response cannot be correlated - did you compose the BaseMessage?")
+	}
+	responseMetadata.SetInReplyTo(originalMetadata.GetID())
+	a.SendMessage(response, original.GetSender())
+}
+
+func (a *BaseAgent[T]) ResolveReply(msg message.IMessage[T]) bool {
+	metadata, ok := msg.(message.IMessageMetadata)
+	if !ok || metadata.GetInReplyTo() == uuid.Nil {
+		return false
+	}
+	a.pendingRequestsLock.Lock()
+	defer a.pendingRequestsLock.Unlock()
+	request, pending := a.pendingRequests[metadata.GetInReplyTo()]
+	if !pending {
+		return false
+	}
+	delete(a.pendingRequests, metadata.GetInReplyTo())
+	request.timeout.Stop()
+	request.reply <- msg
+	close(request.reply)
+	return true
+}
+
+// returns 0 without handling anything when the server is not in mailbox mode, as messages are
+// then handled on delivery
+func (a *BaseAgent[T]) ProcessInbox() int {
+	inbox := a.Inbox(a.id)
+	if inbox == nil {
+		return 0
+	}
+	self := a.AccessAgentByID(a.id)
+	handled := 0
+	for {
+		select {
+		case msg := <-inbox:
+			handlingStarted := time.Now()
+			msg.InvokeMessageHandler(self)
+			a.diagnosticsEngine.ReportHandlerDuration(a.id, time.Since(handlingStarted))
+			handled++
+		default:
+			return handled
+		}
+	}
+}
+
+func (a *BaseAgent[T]) Receive(ctx context.Context) (message.IMessage[T], error) {
+	inbox := a.Inbox(a.id)
+	if inbox == nil {
+		return nil, ErrMailboxDisabled
+	}
+	select {
+	case msg := <-inbox:
+		return msg, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// records a message event, naming the message type as in diagnostics
+func (a *BaseAgent[T]) emitMessageEvent(eventType events.EventType, msg message.IMessage[T], recipient uuid.UUID, detail string) {
+	if !a.HasEventSinks() {
+		return
+	}
+	event := events.CreateMessageEvent(eventType, msg, recipient, detail)
+	event.MessageType = a.GetMessageTypeName(msg)
+	a.EmitEvent(event)
+}
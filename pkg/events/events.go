@@ -0,0 +1,107 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/message"
+	"github.com/google/uuid"
+)
+
+type EventType string
+
+const (
+	AgentAdded        EventType = "agent_added"
+	AgentRemoved      EventType = "agent_removed"
+	IterationStarted  EventType = "iteration_started"
+	IterationEnded    EventType = "iteration_ended"
+	TurnStarted       EventType = "turn_started"
+	TurnEnded         EventType = "turn_ended"
+	PhaseStarted      EventType = "phase_started"
+	PhaseEnded        EventType = "phase_ended"
+	AgentActivated    EventType = "agent_activated"
+	IterationStopped  EventType = "iteration_stopped"
+	RunStopped        EventType = "run_stopped"
+	MessageSent       EventType = "message_sent"
+	MessageDelivered  EventType = "message_delivered"
+	MessageDropped    EventType = "message_dropped"
+	MessagingComplete EventType = "messaging_complete"
+	MessagingTimeout  EventType = "messaging_timeout"
+	RequestTimeout    EventType = "request_timeout"
+)
+
+// reasons recorded against dropped messages
+const (
+	DropBandwidth   = "bandwidth"
+	DropTopology    = "topology"
+	DropNetworkLoss = "network_loss"
+	DropExpired     = "expired"
+	DropStale       = "stale"
+	DropInboxFull   = "inbox_full"
+	DropSessionEnd  = "session_end"
+)
+
+// a single occurrence in a simulation. Fields irrelevant to the event type are left zero
+type Event struct {
+	Type      EventType `json:"type"`
+	Time      time.Time `json:"time"`
+	Iteration int       `json:"iteration"`
+	Turn      int       `json:"turn"`
+	// agent the event concerns (added, removed, finished messaging)
+	Agent uuid.UUID `json:"agent,omitempty"`
+	// sender and recipient of a message event
+	Sender    uuid.UUID `json:"sender,omitempty"`
+	Recipient uuid.UUID `json:"recipient,omitempty"`
+	// concrete type of the message in a message event
+	MessageType string `json:"messageType,omitempty"`
+	// ID of the message in a message event, if it composes BaseMessage
+	MessageID uuid.UUID `json:"messageID,omitempty"`
+	// why a message was dropped, or a count for messaging session events
+	Detail string `json:"detail,omitempty"`
+}
+
+// writes events as JSON, omitting IDs left as uuid.Nil (which omitempty does not detect)
+func (e Event) MarshalJSON() ([]byte, error) {
+	type plainEvent Event
+	return json.Marshal(struct {
+		plainEvent
+		Agent     *uuid.UUID `json:"agent,omitempty"`
+		Sender    *uuid.UUID `json:"sender,omitempty"`
+		Recipient *uuid.UUID `json:"recipient,omitempty"`
+		MessageID *uuid.UUID `json:"messageID,omitempty"`
+	}{plainEvent(e), optionalID(e.Agent), optionalID(e.Sender), optionalID(e.Recipient), optionalID(e.MessageID)})
+}
+
+func optionalID(id uuid.UUID) *uuid.UUID {
+	if id == uuid.Nil {
+		return nil
+	}
+	return &id
+}
+
+// receives the events of a simulation as they occur. Must be safe for concurrent use
+type EventSink interface {
+	Emit(Event)
+}
+
+// returns the name used to identify a message's concrete type in events, unless a server names it otherwise
+func MessageTypeName(msg any) string {
+	return fmt.Sprintf("%T", msg)
+}
+
+// creates an event describing a message, identified by its sender, recipient, type and ID.
+// Servers and agents override the type with the name from their message type registry
+func CreateMessageEvent[T any](eventType EventType, msg message.IMessage[T], recipient uuid.UUID, detail string) Event {
+	event := Event{
+		Type:        eventType,
+		Sender:      msg.GetSender(),
+		Recipient:   recipient,
+		MessageType: MessageTypeName(msg),
+		Detail:      detail,
+	}
+	if metadata, ok := msg.(message.IMessageMetadata); ok {
+		event.MessageID = metadata.GetID()
+	}
+	return event
+}
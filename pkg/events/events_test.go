@@ -0,0 +1,72 @@
+package events_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/MattSScott/basePlatformSOMAS/v2/internal/testUtils"
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/events"
+	"github.com/google/uuid"
+)
+
+func TestJSONLinesSink(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	sink := events.CreateJSONLinesSink(buffer)
+	agentID := uuid.New()
+	sink.Emit(events.Event{Type: events.AgentAdded, Agent: agentID})
+	sink.Emit(events.Event{Type: events.TurnStarted, Iteration: 2, Turn: 3})
+	if sink.Err() != nil {
+		t.Fatal("Sink failed to write:", sink.Err())
+	}
+	written := buffer.String()
+	scanner := bufio.NewScanner(buffer)
+	decoded := []events.Event{}
+	for scanner.Scan() {
+		var event events.Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatal("Line is not a JSON event:", scanner.Text())
+		}
+		decoded = append(decoded, event)
+	}
+	if len(decoded) != 2 {
+		t.Fatal("Expected 2 lines, got:", len(decoded))
+	}
+	if decoded[0].Type != events.AgentAdded || decoded[0].Agent != agentID {
+		t.Error("First event not decoded correctly:", decoded[0])
+	}
+	if decoded[1].Iteration != 2 || decoded[1].Turn != 3 {
+		t.Error("Second event not decoded correctly:", decoded[1])
+	}
+	if strings.Contains(written, uuid.Nil.String()) {
+		t.Error("Unset IDs written as nil UUIDs:", written)
+	}
+}
+
+func TestSlogSink(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	logger := slog.New(slog.NewJSONHandler(buffer, nil))
+	sink := events.CreateSlogSink(logger, slog.LevelInfo)
+	msg := testUtils.NewTestMessage()
+	recipient := uuid.New()
+	sink.Emit(events.CreateMessageEvent(events.MessageDropped, msg, recipient, events.DropBandwidth))
+	var record map[string]any
+	if err := json.Unmarshal(buffer.Bytes(), &record); err != nil {
+		t.Fatal("Log record is not JSON:", buffer.String())
+	}
+	if record["msg"] != string(events.MessageDropped) || record["detail"] != events.DropBandwidth {
+		t.Error("Log record missing event type or detail:", buffer.String())
+	}
+	if record["recipient"] != recipient.String() {
+		t.Error("Log record missing recipient:", buffer.String())
+	}
+	if _, ok := record["agent"]; ok {
+		t.Error("Log record includes unset agent field")
+	}
+	if !strings.Contains(record["messageType"].(string), "TestMessage") {
+		t.Error("Log record missing message type:", buffer.String())
+	}
+}
@@ -0,0 +1,82 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// writes each event as a line of JSON
+type JSONLinesSink struct {
+	lock    sync.Mutex
+	encoder *json.Encoder
+	// first error encountered while writing, after which events are discarded
+	err error
+}
+
+func CreateJSONLinesSink(w io.Writer) *JSONLinesSink {
+	return &JSONLinesSink{
+		encoder: json.NewEncoder(w),
+	}
+}
+
+func (s *JSONLinesSink) Emit(event Event) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.err != nil {
+		return
+	}
+	s.err = s.encoder.Encode(event)
+}
+
+// returns the first error encountered while writing events
+func (s *JSONLinesSink) Err() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.err
+}
+
+// logs each event as a structured log record
+type SlogSink struct {
+	logger *slog.Logger
+	level  slog.Level
+}
+
+func CreateSlogSink(logger *slog.Logger, level slog.Level) *SlogSink {
+	return &SlogSink{
+		logger: logger,
+		level:  level,
+	}
+}
+
+func (s *SlogSink) Emit(event Event) {
+	attrs := []slog.Attr{
+		slog.Int("iteration", event.Iteration),
+		slog.Int("turn", event.Turn),
+	}
+	ids := []struct {
+		key string
+		id  uuid.UUID
+	}{
+		{"agent", event.Agent},
+		{"sender", event.Sender},
+		{"recipient", event.Recipient},
+		{"messageID", event.MessageID},
+	}
+	for _, entry := range ids {
+		if entry.id != uuid.Nil {
+			attrs = append(attrs, slog.String(entry.key, entry.id.String()))
+		}
+	}
+	if event.MessageType != "" {
+		attrs = append(attrs, slog.String("messageType", event.MessageType))
+	}
+	if event.Detail != "" {
+		attrs = append(attrs, slog.String("detail", event.Detail))
+	}
+	s.logger.LogAttrs(context.Background(), s.level, string(event.Type), attrs...)
+}
@@ -0,0 +1,175 @@
+package message
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// wire format of an encoded message - the payload is decoded according to the registered type name
+type Envelope struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// binary counterpart of Envelope, with a gob-encoded payload
+type binaryEnvelope struct {
+	Type    string
+	Payload []byte
+}
+
+// maps concrete message types to names, allowing messages to be encoded and decoded
+// without the receiver knowing their type in advance
+type CodecRegistry[T any] struct {
+	lock sync.RWMutex
+	// type name -> concrete message type
+	types map[string]reflect.Type
+	// concrete message type -> type name
+	names map[reflect.Type]string
+}
+
+func CreateCodecRegistry[T any]() *CodecRegistry[T] {
+	return &CodecRegistry[T]{
+		types: make(map[string]reflect.Type),
+		names: make(map[reflect.Type]string),
+	}
+}
+
+// registers the concrete type of the prototype message (usually a pointer to a struct
+// composing BaseMessage) under a unique name
+func (cr *CodecRegistry[T]) Register(name string, prototype IMessage[T]) error {
+	if prototype == nil {
+		return fmt.Errorf("nil prototype registered for message type %q", name)
+	}
+	msgType := reflect.TypeOf(prototype)
+	cr.lock.Lock()
+	defer cr.lock.Unlock()
+	if existing, ok := cr.types[name]; ok && existing != msgType {
+		return fmt.Errorf("message type name %q already registered to %v", name, existing)
+	}
+	if existing, ok := cr.names[msgType]; ok && existing != name {
+		return fmt.Errorf("message type %v already registered as %q", msgType, existing)
+	}
+	cr.types[name] = msgType
+	cr.names[msgType] = name
+	return nil
+}
+
+// returns the registered name of the message's concrete type
+func (cr *CodecRegistry[T]) TypeName(msg IMessage[T]) (string, bool) {
+	cr.lock.RLock()
+	defer cr.lock.RUnlock()
+	name, ok := cr.names[reflect.TypeOf(msg)]
+	return name, ok
+}
+
+func (cr *CodecRegistry[T]) requireTypeName(msg IMessage[T]) (string, error) {
+	name, ok := cr.TypeName(msg)
+	if !ok {
+		return "", fmt.Errorf("message type %T has not been registered", msg)
+	}
+	return name, nil
+}
+
+// creates a pointer to a zero-valued message of the named type, to decode into
+func (cr *CodecRegistry[T]) newTarget(name string) (any, error) {
+	cr.lock.RLock()
+	msgType, ok := cr.types[name]
+	cr.lock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown message type %q", name)
+	}
+	if msgType.Kind() == reflect.Pointer {
+		msgType = msgType.Elem()
+	}
+	return reflect.New(msgType).Interface(), nil
+}
+
+// converts a decoded target back to the registered (pointer or value) type
+func (cr *CodecRegistry[T]) fromTarget(name string, target any) (IMessage[T], error) {
+	cr.lock.RLock()
+	msgType := cr.types[name]
+	cr.lock.RUnlock()
+	value := reflect.ValueOf(target)
+	if msgType.Kind() != reflect.Pointer {
+		value = value.Elem()
+	}
+	msg, ok := value.Interface().(IMessage[T])
+	if !ok {
+		return nil, fmt.Errorf("decoded value of type %v is not a message", value.Type())
+	}
+	return msg, nil
+}
+
+// encodes a message as a JSON envelope stamped with its registered type name
+func (cr *CodecRegistry[T]) EncodeJSON(msg IMessage[T]) ([]byte, error) {
+	name, err := cr.requireTypeName(msg)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(Envelope{Type: name, Payload: payload})
+}
+
+// decodes a JSON envelope into a message of its stamped type
+func (cr *CodecRegistry[T]) DecodeJSON(data []byte) (IMessage[T], error) {
+	var envelope Envelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, err
+	}
+	target, err := cr.newTarget(envelope.Type)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(envelope.Payload, target); err != nil {
+		return nil, fmt.Errorf("unable to decode %q payload: %w", envelope.Type, err)
+	}
+	return cr.fromTarget(envelope.Type, target)
+}
+
+// encodes a message as a gob envelope stamped with its registered type name
+func (cr *CodecRegistry[T]) EncodeBinary(msg IMessage[T]) ([]byte, error) {
+	name, err := cr.requireTypeName(msg)
+	if err != nil {
+		return nil, err
+	}
+	var payload bytes.Buffer
+	if err := gob.NewEncoder(&payload).Encode(msg); err != nil {
+		return nil, err
+	}
+	var encoded bytes.Buffer
+	err = gob.NewEncoder(&encoded).Encode(binaryEnvelope{Type: name, Payload: payload.Bytes()})
+	return encoded.Bytes(), err
+}
+
+// decodes a gob envelope into a message of its stamped type
+func (cr *CodecRegistry[T]) DecodeBinary(data []byte) (IMessage[T], error) {
+	var envelope binaryEnvelope
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&envelope); err != nil {
+		return nil, err
+	}
+	target, err := cr.newTarget(envelope.Type)
+	if err != nil {
+		return nil, err
+	}
+	if err := gob.NewDecoder(bytes.NewReader(envelope.Payload)).Decode(target); err != nil {
+		return nil, fmt.Errorf("unable to decode %q payload: %w", envelope.Type, err)
+	}
+	return cr.fromTarget(envelope.Type, target)
+}
+
+// encodes a message as JSON, allowing the registry to be used as a transport codec
+func (cr *CodecRegistry[T]) Encode(msg IMessage[T]) ([]byte, error) {
+	return cr.EncodeJSON(msg)
+}
+
+// decodes a message encoded with Encode
+func (cr *CodecRegistry[T]) Decode(data []byte) (IMessage[T], error) {
+	return cr.DecodeJSON(data)
+}
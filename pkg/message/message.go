@@ -1,6 +1,8 @@
 package message
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 )
 
@@ -12,11 +14,76 @@ type IMessage[T any] interface {
 	InvokeMessageHandler(T)
 }
 
+// metadata carried by messages composing BaseMessage, for correlating and tracing conversations
+type IMessageMetadata interface {
+	// returns the unique ID of a message
+	GetID() uuid.UUID
+	// returns the iteration in which a message was created (-1 if outside a run)
+	GetIteration() int
+	// returns the turn in which a message was created (-1 if outside a turn)
+	GetTurn() int
+	// returns the time at which a message was created
+	GetSentAt() time.Time
+	// returns the ID of the message this one responds to (uuid.Nil if none)
+	GetInReplyTo() uuid.UUID
+	// returns how long after creation a message may still be delivered (0 if it never expires)
+	GetTTL() time.Duration
+	// reports whether a message has outlived its TTL at the given time
+	IsExpired(time.Time) bool
+	// reports whether a message was sent in a turn other than the given iteration and turn (never if sent outside a turn)
+	IsStale(iteration, turn int) bool
+	// marks a message as a response to the message with the given ID
+	SetInReplyTo(uuid.UUID)
+}
+
 // new message types can extend this
 type BaseMessage struct {
-	Sender uuid.UUID
+	Sender    uuid.UUID
+	ID        uuid.UUID
+	Iteration int
+	Turn      int
+	SentAt    time.Time
+	InReplyTo uuid.UUID
+	// ignored in deterministic mode, where messages only expire at the end of the turn they were sent in
+	TTL time.Duration
 }
 
 func (bm *BaseMessage) GetSender() uuid.UUID {
 	return bm.Sender
 }
+
+func (bm *BaseMessage) GetID() uuid.UUID {
+	return bm.ID
+}
+
+func (bm *BaseMessage) GetIteration() int {
+	return bm.Iteration
+}
+
+func (bm *BaseMessage) GetTurn() int {
+	return bm.Turn
+}
+
+func (bm *BaseMessage) GetSentAt() time.Time {
+	return bm.SentAt
+}
+
+func (bm *BaseMessage) GetInReplyTo() uuid.UUID {
+	return bm.InReplyTo
+}
+
+func (bm *BaseMessage) SetInReplyTo(id uuid.UUID) {
+	bm.InReplyTo = id
+}
+
+func (bm *BaseMessage) GetTTL() time.Duration {
+	return bm.TTL
+}
+
+func (bm *BaseMessage) IsExpired(now time.Time) bool {
+	return bm.TTL > 0 && now.Sub(bm.SentAt) > bm.TTL
+}
+
+func (bm *BaseMessage) IsStale(iteration, turn int) bool {
+	return bm.Turn >= 0 && (bm.Iteration != iteration || bm.Turn != turn)
+}
@@ -1,6 +1,7 @@
 package message_test
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 
@@ -62,3 +63,77 @@ func TestGetSender(t *testing.T) {
 		t.Errorf("Message has sender ID: %s, expected: %s", msgSenderID, agID)
 	}
 }
+
+func createTestRegistry(t *testing.T) *message.CodecRegistry[testUtils.IExtendedAgent] {
+	registry := message.CreateCodecRegistry[testUtils.IExtendedAgent]()
+	if err := registry.Register("message1", &testUtils.Message1{}); err != nil {
+		t.Fatal("Unable to register Message1:", err)
+	}
+	if err := registry.Register("message2", &testUtils.Message2{}); err != nil {
+		t.Fatal("Unable to register Message2:", err)
+	}
+	return registry
+}
+
+func TestCodecRegistryJSONRoundTrip(t *testing.T) {
+	server := server.CreateBaseServer[testUtils.IExtendedAgent](1, 1, time.Second, 100000)
+	a1 := testUtils.NewExtendedAgent(server)
+	a2 := testUtils.NewExtendedAgent(server)
+	registry := createTestRegistry(t)
+	encoded, err := registry.EncodeJSON(a1.GetMessage2())
+	if err != nil {
+		t.Fatal("Unable to encode message:", err)
+	}
+	var envelope message.Envelope
+	if err := json.Unmarshal(encoded, &envelope); err != nil || envelope.Type != "message2" {
+		t.Error("Envelope not stamped with type name, got:", string(encoded))
+	}
+	decoded, err := registry.DecodeJSON(encoded)
+	if err != nil {
+		t.Fatal("Unable to decode message:", err)
+	}
+	if decoded.GetSender() != a1.GetID() {
+		t.Errorf("Decoded message has sender %s, expected %s", decoded.GetSender(), a1.GetID())
+	}
+	decoded.InvokeMessageHandler(a2)
+	if a2.GetAgentField() != 10 {
+		t.Error("Decoded message not dispatched to the correct handler")
+	}
+}
+
+func TestCodecRegistryBinaryRoundTrip(t *testing.T) {
+	server := server.CreateBaseServer[testUtils.IExtendedAgent](1, 1, time.Second, 100000)
+	a1 := testUtils.NewExtendedAgent(server)
+	registry := createTestRegistry(t)
+	encoded, err := registry.EncodeBinary(a1.GetMessage1())
+	if err != nil {
+		t.Fatal("Unable to encode message:", err)
+	}
+	decoded, err := registry.DecodeBinary(encoded)
+	if err != nil {
+		t.Fatal("Unable to decode message:", err)
+	}
+	msg1, ok := decoded.(*testUtils.Message1)
+	if !ok {
+		t.Fatalf("Decoded message has type %T, expected *Message1", decoded)
+	}
+	if msg1.GetSender() != a1.GetID() || msg1.MessageField1 != 5 {
+		t.Error("Decoded message fields do not match original:", msg1)
+	}
+}
+
+func TestCodecRegistryRejectsUnknownTypes(t *testing.T) {
+	registry := createTestRegistry(t)
+	if _, err := registry.EncodeJSON(&testUtils.NullMessage{}); err == nil {
+		t.Error("Unregistered message type was encoded")
+	}
+	if _, err := registry.DecodeJSON([]byte(`{"type":"unknown","payload":{}}`)); err == nil {
+		t.Error("Unknown message type was decoded")
+	}
+	if err := registry.Register("message1", &testUtils.NullMessage{}); err == nil {
+		t.Error("Type name registered twice")
+	}
+	if err := registry.Register("message1", &testUtils.Message1{}); err != nil {
+		t.Error("Repeated identical registration rejected:", err)
+	}
+}
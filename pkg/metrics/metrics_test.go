@@ -0,0 +1,110 @@
+package metrics_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MattSScott/basePlatformSOMAS/v2/internal/testUtils"
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/metrics"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	iterations, turns, numAgents := 2, 2, 3
+	testServer := testUtils.GenerateDeterministicTestServer(1, numAgents, iterations, turns, 10*time.Millisecond, 100)
+	testServer.SetGameRunner(testServer)
+	testServer.Start()
+	var output bytes.Buffer
+	if err := metrics.CreateExporter(testServer).WriteMetrics(&output); err != nil {
+		t.Fatal(err)
+	}
+	exposition := output.String()
+	expectedLines := []string{
+		"# TYPE somas_iteration gauge",
+		"somas_iteration -1",
+		"somas_agents 3",
+		"# TYPE somas_messages_sent counter",
+		"somas_messages_sent_total 24",
+		"somas_turns_completed_total 4",
+		"somas_turn_network_effects{effect=\"loss\"} 0",
+		"# TYPE somas_handler_duration_seconds histogram",
+		"somas_handler_duration_seconds_count 24",
+	}
+	for _, line := range expectedLines {
+		if !strings.Contains(exposition, line+"\n") {
+			t.Errorf("Expected line %q in exposition", line)
+		}
+	}
+	if !strings.HasSuffix(exposition, "# EOF\n") {
+		t.Error("Exposition not terminated with # EOF")
+	}
+}
+
+func TestHistogramsAccumulateAcrossTurns(t *testing.T) {
+	testServer := testUtils.GenerateDeterministicTestServer(1, 3, 1, 2, 10*time.Millisecond, 100)
+	testServer.SetGameRunner(testServer)
+	exporter := metrics.CreateExporter(testServer)
+	testServer.Start()
+	var first bytes.Buffer
+	exporter.WriteMetrics(&first)
+	testServer.Start()
+	var second bytes.Buffer
+	exporter.WriteMetrics(&second)
+	if !strings.Contains(first.String(), "somas_handler_duration_seconds_count 12\n") {
+		t.Errorf("Unexpected exposition after first run:\n%s", first.String())
+	}
+	if !strings.Contains(second.String(), "somas_handler_duration_seconds_count 24\n") {
+		t.Errorf("Histogram reset between runs:\n%s", second.String())
+	}
+}
+
+func TestWriteMetricsWhileAddingAgents(t *testing.T) {
+	testServer := testUtils.GenerateDeterministicTestServer(1, 3, 1, 1, 10*time.Millisecond, 100)
+	exporter := metrics.CreateExporter(testServer)
+	added := make(chan struct{})
+	go func() {
+		defer close(added)
+		for i := 0; i < 50; i++ {
+			testServer.AddAgent(testUtils.NewTestAgent(testServer))
+		}
+	}()
+	for scraping := true; scraping; {
+		select {
+		case <-added:
+			scraping = false
+		default:
+			if err := exporter.WriteMetrics(io.Discard); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	var output bytes.Buffer
+	exporter.WriteMetrics(&output)
+	if !strings.Contains(output.String(), "somas_agents 53\n") {
+		t.Errorf("Unexpected agent count in exposition:\n%s", output.String())
+	}
+}
+
+func TestServeMetrics(t *testing.T) {
+	testServer := testUtils.GenerateDeterministicTestServer(1, 2, 1, 1, 10*time.Millisecond, 100)
+	httpServer, err := metrics.CreateExporter(testServer).ListenAndServe("localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer httpServer.Close()
+	response, err := http.Get("http://" + httpServer.Addr + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if !strings.HasPrefix(response.Header.Get("Content-Type"), "application/openmetrics-text") {
+		t.Errorf("Unexpected content type %q", response.Header.Get("Content-Type"))
+	}
+	body, _ := io.ReadAll(response.Body)
+	if !strings.Contains(string(body), "somas_agents 2\n") {
+		t.Errorf("Unexpected exposition:\n%s", body)
+	}
+}
@@ -0,0 +1,134 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/MattSScott/basePlatformSOMAS/v2/internal/diagnosticsEngine"
+)
+
+const contentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// the parts of a server read by the exporter (satisfied by server.BaseServer)
+type MetricsSource interface {
+	GetDiagnosticEngine() diagnosticsEngine.IDiagnosticsEngine
+	GetCurrentIteration() int
+	GetCurrentTurn() int
+	GetAgentCount() int
+}
+
+var networkEffectLabels = map[diagnosticsEngine.NetworkEffect]string{
+	diagnosticsEngine.NetworkLoss:        "loss",
+	diagnosticsEngine.NetworkDuplication: "duplication",
+	diagnosticsEngine.NetworkReordering:  "reordering",
+	diagnosticsEngine.NetworkDelay:       "delay",
+}
+
+// exposes a server's progress and messaging diagnostics in the OpenMetrics text format.
+// Per-turn values describe the turn in progress and are exported as gauges, while totals cover
+// the turns completed in the run. Timing histograms accumulate over the server's lifetime
+type Exporter struct {
+	source MetricsSource
+	// prefix of every metric name
+	namespace string
+}
+
+func CreateExporter(source MetricsSource) *Exporter {
+	return &Exporter{
+		source:    source,
+		namespace: "somas",
+	}
+}
+
+// writes a single exposition of all metrics, terminated by # EOF
+func (e *Exporter) WriteMetrics(w io.Writer) error {
+	buffered := bufio.NewWriter(w)
+	engine := e.source.GetDiagnosticEngine()
+	summary := engine.GetHistorySummary()
+
+	e.writeGauge(buffered, "iteration", "Iteration in progress (-1 outside a run)", float64(e.source.GetCurrentIteration()))
+	e.writeGauge(buffered, "turn", "Turn in progress (-1 outside a turn)", float64(e.source.GetCurrentTurn()))
+	e.writeGauge(buffered, "agents", "Number of agents on the server", float64(e.source.GetAgentCount()))
+
+	e.writeCounter(buffered, "turns_completed", "Turns completed in the run", summary.Turns)
+	e.writeCounter(buffered, "messages_sent", "Messages sent in completed turns", summary.TotalSent)
+	e.writeCounter(buffered, "messages_delivered", "Messages accepted for delivery in completed turns", summary.TotalDelivered)
+	e.writeCounter(buffered, "messages_dropped", "Messages dropped in completed turns", summary.TotalDropped)
+
+	e.writeGauge(buffered, "turn_messages_sent", "Messages sent in the current turn", float64(engine.GetNumberSentMessages()))
+	e.writeGauge(buffered, "turn_messages_delivered", "Messages accepted for delivery in the current turn", float64(engine.GetNumberMessageSuccesses()))
+	e.writeGauge(buffered, "turn_messages_dropped", "Messages dropped in the current turn", float64(engine.GetNumberMessageDrops()))
+	e.writeGauge(buffered, "turn_messaging_success_ratio", "Fraction of messages sent in the current turn that were not dropped", float64(engine.GetMessagingSuccessRate())/100)
+	e.writeGauge(buffered, "turn_end_messagings", "Agents that signalled messaging complete in the last session", float64(engine.GetNumberEndMessagings()))
+	e.writeGauge(buffered, "turn_request_timeouts", "Requests that timed out in the current turn", float64(engine.GetNumberRequestTimeouts()))
+	e.writeGauge(buffered, "turn_inbox_overflows", "Messages dropped by full inboxes in the current turn", float64(engine.GetNumberInboxOverflows()))
+
+	name := e.namespace + "_turn_network_effects"
+	writeMetadata(buffered, name, "gauge", "Messages affected by the simulated network in the current turn")
+	for effect := diagnosticsEngine.NetworkLoss; effect <= diagnosticsEngine.NetworkDelay; effect++ {
+		fmt.Fprintf(buffered, "%s{effect=%q} %d\n", name, networkEffectLabels[effect], engine.GetNumberNetworkEffects(effect))
+	}
+
+	e.writeHistogram(buffered, "delivery_latency_seconds", "Time from sending to delivery of messages", engine.GetTotalDeliveryLatencies())
+	e.writeHistogram(buffered, "handler_duration_seconds", "Time spent in message handlers", engine.GetTotalHandlerDurations())
+	e.writeHistogram(buffered, "messaging_complete_seconds", "Time into each turn at which agents signalled messaging complete", engine.GetTotalMessagingCompleteTimes())
+
+	fmt.Fprintln(buffered, "# EOF")
+	return buffered.Flush()
+}
+
+func writeMetadata(w io.Writer, name, metricType, help string) {
+	fmt.Fprintf(w, "# TYPE %s %s\n# HELP %s %s\n", name, metricType, name, help)
+}
+
+func (e *Exporter) writeGauge(w io.Writer, name, help string, value float64) {
+	name = e.namespace + "_" + name
+	writeMetadata(w, name, "gauge", help)
+	fmt.Fprintf(w, "%s %s\n", name, formatFloat(value))
+}
+
+func (e *Exporter) writeCounter(w io.Writer, name, help string, value int) {
+	name = e.namespace + "_" + name
+	writeMetadata(w, name, "counter", help)
+	fmt.Fprintf(w, "%s_total %d\n", name, value)
+}
+
+func (e *Exporter) writeHistogram(w io.Writer, name, help string, histogram diagnosticsEngine.HistogramSnapshot) {
+	name = e.namespace + "_" + name
+	writeMetadata(w, name, "histogram", help)
+	cumulative := 0
+	for i, bound := range histogram.Bounds {
+		cumulative += histogram.Counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", name, formatFloat(bound.Seconds()), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, histogram.Count)
+	fmt.Fprintf(w, "%s_sum %s\n", name, formatFloat(histogram.Sum.Seconds()))
+	fmt.Fprintf(w, "%s_count %d\n", name, histogram.Count)
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	e.WriteMetrics(w)
+}
+
+// serves the metrics at /metrics on the given address (e.g. "localhost:9090") until the returned
+// server is shut down. An error is returned if the address cannot be listened on
+func (e *Exporter) ListenAndServe(addr string) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", e)
+	httpServer := &http.Server{Addr: listener.Addr().String(), Handler: mux}
+	go httpServer.Serve(listener)
+	return httpServer, nil
+}
@@ -0,0 +1,131 @@
+package network
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// draws a message latency from a distribution
+type LatencyDistribution func(*rand.Rand) time.Duration
+
+func ConstantLatency(latency time.Duration) LatencyDistribution {
+	return func(*rand.Rand) time.Duration {
+		return latency
+	}
+}
+
+// uniformly distributed latency between the bounds, which may be given in either order
+func UniformLatency(min, max time.Duration) LatencyDistribution {
+	if max < min {
+		min, max = max, min
+	}
+	return func(rng *rand.Rand) time.Duration {
+		return min + time.Duration(rng.Int63n(int64(max-min)+1))
+	}
+}
+
+// normally distributed latency, truncated at zero
+func NormalLatency(mean, stdDev time.Duration) LatencyDistribution {
+	return func(rng *rand.Rand) time.Duration {
+		sample := float64(mean) + rng.NormFloat64()*float64(stdDev)
+		return time.Duration(math.Max(0, sample))
+	}
+}
+
+func ExponentialLatency(mean time.Duration) LatencyDistribution {
+	return func(rng *rand.Rand) time.Duration {
+		return time.Duration(rng.ExpFloat64() * float64(mean))
+	}
+}
+
+// unreliability of the link between a sender and recipient
+type LinkModel struct {
+	// distribution of delivery latency (nil for instantaneous delivery)
+	Latency LatencyDistribution
+	// probability that a message is lost
+	LossProbability float64
+	// probability that a message is delivered twice
+	DuplicationProbability float64
+	// probability that a message is held back, allowing later messages to overtake it
+	ReorderProbability float64
+	// extra delay applied to held back messages
+	ReorderDelay time.Duration
+}
+
+// what happens to a single message sent across a link
+type Fate struct {
+	// delay before each copy of the message is delivered, in increasing order (empty if lost)
+	Delays     []time.Duration
+	Lost       bool
+	Duplicated bool
+	Reordered  bool
+	Delayed    bool
+}
+
+// simulates unreliable communication, with a default link model and optional per-link overrides
+type ChannelModel struct {
+	lock sync.Mutex
+	// model applied to links without an override
+	defaultLink LinkModel
+	// map of (sender, recipient) -> model for that direction of the link
+	links map[[2]uuid.UUID]LinkModel
+	// source of randomness, seeded for reproducible runs
+	rng *rand.Rand
+}
+
+func CreateChannelModel(defaultLink LinkModel, seed int64) *ChannelModel {
+	return &ChannelModel{
+		defaultLink: defaultLink,
+		links:       make(map[[2]uuid.UUID]LinkModel),
+		rng:         rand.New(rand.NewSource(seed)),
+	}
+}
+
+// overrides the model for messages from sender to recipient
+func (cm *ChannelModel) SetLink(sender, recipient uuid.UUID, link LinkModel) {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	cm.links[[2]uuid.UUID{sender, recipient}] = link
+}
+
+// decides the fate of a message sent from sender to recipient
+func (cm *ChannelModel) Sample(sender, recipient uuid.UUID) Fate {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	link, ok := cm.links[[2]uuid.UUID{sender, recipient}]
+	if !ok {
+		link = cm.defaultLink
+	}
+	fate := Fate{Delays: []time.Duration{}}
+	if cm.rng.Float64() < link.LossProbability {
+		fate.Lost = true
+		return fate
+	}
+	copies := 1
+	if cm.rng.Float64() < link.DuplicationProbability {
+		fate.Duplicated = true
+		copies = 2
+	}
+	for i := 0; i < copies; i++ {
+		delay := time.Duration(0)
+		if link.Latency != nil {
+			delay = link.Latency(cm.rng)
+		}
+		if cm.rng.Float64() < link.ReorderProbability {
+			fate.Reordered = true
+			delay += link.ReorderDelay
+		}
+		if delay > 0 {
+			fate.Delayed = true
+		}
+		fate.Delays = append(fate.Delays, delay)
+	}
+	if copies == 2 && fate.Delays[1] < fate.Delays[0] {
+		fate.Delays[0], fate.Delays[1] = fate.Delays[1], fate.Delays[0]
+	}
+	return fate
+}
@@ -0,0 +1,99 @@
+package network_test
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/network"
+	"github.com/google/uuid"
+)
+
+func TestReliableLink(t *testing.T) {
+	model := network.CreateChannelModel(network.LinkModel{}, 1)
+	fate := model.Sample(uuid.New(), uuid.New())
+	if fate.Lost || fate.Duplicated || fate.Reordered || fate.Delayed {
+		t.Error("Reliable link affected message:", fate)
+	}
+	if len(fate.Delays) != 1 || fate.Delays[0] != 0 {
+		t.Error("Expected a single instant delivery, got:", fate.Delays)
+	}
+}
+
+func TestLossAndDuplication(t *testing.T) {
+	lossy := network.CreateChannelModel(network.LinkModel{LossProbability: 1}, 1)
+	if fate := lossy.Sample(uuid.New(), uuid.New()); !fate.Lost || len(fate.Delays) != 0 {
+		t.Error("Message not lost on fully lossy link")
+	}
+	duplicating := network.CreateChannelModel(network.LinkModel{DuplicationProbability: 1}, 1)
+	if fate := duplicating.Sample(uuid.New(), uuid.New()); !fate.Duplicated || len(fate.Delays) != 2 {
+		t.Error("Message not duplicated on fully duplicating link")
+	}
+}
+
+func TestLatencyAndReordering(t *testing.T) {
+	latency := 20 * time.Millisecond
+	reorderDelay := 100 * time.Millisecond
+	model := network.CreateChannelModel(network.LinkModel{
+		Latency:            network.ConstantLatency(latency),
+		ReorderProbability: 1,
+		ReorderDelay:       reorderDelay,
+	}, 1)
+	fate := model.Sample(uuid.New(), uuid.New())
+	if !fate.Delayed || !fate.Reordered || fate.Delays[0] != latency+reorderDelay {
+		t.Error("Expected delay of", latency+reorderDelay, "got:", fate)
+	}
+}
+
+func TestPerLinkOverride(t *testing.T) {
+	sender, recipient := uuid.New(), uuid.New()
+	model := network.CreateChannelModel(network.LinkModel{}, 1)
+	model.SetLink(sender, recipient, network.LinkModel{LossProbability: 1})
+	if !model.Sample(sender, recipient).Lost {
+		t.Error("Link override not applied")
+	}
+	if model.Sample(recipient, sender).Lost {
+		t.Error("Link override applied in reverse direction")
+	}
+}
+
+func TestLossRateAndReproducibility(t *testing.T) {
+	samples := 10000
+	lossProbability := 0.3
+	sender, recipient := uuid.New(), uuid.New()
+	model1 := network.CreateChannelModel(network.LinkModel{LossProbability: lossProbability}, 7)
+	model2 := network.CreateChannelModel(network.LinkModel{LossProbability: lossProbability}, 7)
+	losses := 0
+	for i := 0; i < samples; i++ {
+		lost := model1.Sample(sender, recipient).Lost
+		if lost != model2.Sample(sender, recipient).Lost {
+			t.Fatal("Identically seeded channel models diverged")
+		}
+		if lost {
+			losses++
+		}
+	}
+	rate := float64(losses) / float64(samples)
+	if rate < lossProbability-0.03 || rate > lossProbability+0.03 {
+		t.Error("Loss rate", rate, "far from configured", lossProbability)
+	}
+}
+
+func TestLatencyDistributions(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	min, max := 10*time.Millisecond, 20*time.Millisecond
+	for i := 0; i < 1000; i++ {
+		if sample := network.UniformLatency(min, max)(rng); sample < min || sample > max {
+			t.Fatal("Uniform latency out of range:", sample)
+		}
+		if sample := network.UniformLatency(max, min)(rng); sample < min || sample > max {
+			t.Fatal("Uniform latency with swapped bounds out of range:", sample)
+		}
+		if network.NormalLatency(time.Millisecond, time.Second)(rng) < 0 {
+			t.Fatal("Normal latency not truncated at zero")
+		}
+		if network.ExponentialLatency(time.Millisecond)(rng) < 0 {
+			t.Fatal("Exponential latency negative")
+		}
+	}
+}
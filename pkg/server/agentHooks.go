@@ -0,0 +1,80 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/agent"
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/transport"
+)
+
+// invokes agent lifecycle hooks concurrently, rather than one agent at a time in order of addition (default false)
+func (serv *BaseServer[T]) SetParallelAgentHooks(parallel bool) {
+	serv.parallelAgentHooks = parallel
+}
+
+// calls invoke on every agent, waiting for all calls to return
+func (serv *BaseServer[T]) invokeAgentHooks(invoke func(T)) {
+	if !serv.parallelAgentHooks {
+		for _, id := range serv.agentOrder {
+			invoke(serv.agentMap[id])
+		}
+		return
+	}
+	var wg sync.WaitGroup
+	for _, id := range serv.agentOrder {
+		wg.Add(1)
+		go func(ag T) {
+			defer wg.Done()
+			invoke(ag)
+		}(serv.agentMap[id])
+	}
+	wg.Wait()
+}
+
+func (serv *BaseServer[T]) notifyIterationStart(iteration int) {
+	serv.forwardLifecycle(transport.StageIterationStart, iteration, -1)
+	serv.invokeAgentHooks(func(ag T) {
+		if hook, ok := any(ag).(agent.IterationStartHook); ok {
+			hook.OnIterationStart(iteration)
+		}
+	})
+}
+
+func (serv *BaseServer[T]) notifyIterationEnd(iteration int) {
+	serv.forwardLifecycle(transport.StageIterationEnd, iteration, -1)
+	serv.invokeAgentHooks(func(ag T) {
+		if hook, ok := any(ag).(agent.IterationEndHook); ok {
+			hook.OnIterationEnd(iteration)
+		}
+	})
+}
+
+func (serv *BaseServer[T]) notifyTurnStart(iteration, turn int) {
+	serv.forwardLifecycle(transport.StageTurnStart, iteration, turn)
+	serv.invokeAgentHooks(func(ag T) {
+		if hook, ok := any(ag).(agent.TurnStartHook); ok {
+			hook.OnTurnStart(iteration, turn)
+		}
+	})
+}
+
+func (serv *BaseServer[T]) notifyTurnEnd(iteration, turn int) {
+	serv.forwardLifecycle(transport.StageTurnEnd, iteration, turn)
+	serv.invokeAgentHooks(func(ag T) {
+		if hook, ok := any(ag).(agent.TurnEndHook); ok {
+			hook.OnTurnEnd(iteration, turn)
+		}
+	})
+}
+
+func (serv *BaseServer[T]) notifyAdded(ag T) {
+	if hook, ok := any(ag).(agent.AddedHook); ok {
+		hook.OnAdded()
+	}
+}
+
+func (serv *BaseServer[T]) notifyRemoved(ag T) {
+	if hook, ok := any(ag).(agent.RemovedHook); ok {
+		hook.OnRemoved()
+	}
+}
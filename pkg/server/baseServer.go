@@ -2,12 +2,23 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/MattSScott/basePlatformSOMAS/v2/internal/diagnosticsEngine"
 	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/agent"
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/events"
 	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/message"
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/network"
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/topology"
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/transport"
 	"github.com/google/uuid"
 )
 
@@ -16,26 +27,139 @@ type BaseServer[T agent.IAgent[T]] struct {
 	agentMap map[uuid.UUID]T
 	// hashset of agent IDs
 	agentIdSet map[uuid.UUID]struct{}
+	// agent IDs in order of addition, giving a stable iteration order
+	agentOrder []uuid.UUID
+	// number of agents on the server, readable while agents are added and removed
+	agentCount atomic.Int64
 	// channel a server goroutine will send to in order to signal messaging completion
 	agentFinishedMessaging chan uuid.UUID
 	// duration after which messaging phase forcefully ends during turns
 	turnTimeout time.Duration
 	// interface which allows overridable turns
-	gameRunner GameRunner
+	gameRunner FallibleGameRunner
 	// number of iterations for server
 	iterations int
 	// number of turns for server
 	turns int
 	// closable channel to signify that messaging is complete
 	endNotifyAgentDone chan struct{}
+	// whether a messaging session is open, and whether every session ended so far in the turn completed in time
+	sessionOpen           bool
+	turnMessagingComplete bool
 	//the max number of sent messages the server will process concurrently from each agent at one time. Anymore sent will be dropped
 	agentMessagingBandwidth int
 	// diagnostic engine
 	diagnosticsEngine diagnosticsEngine.IDiagnosticsEngine
 	//flag which controls whether diagnostics are reported
 	reportMessagingDiagnostics bool
+	// destination of the diagnostics reported by ReportMessagingDiagnostics (os.Stdout)
+	consoleWriter io.Writer
+	// destinations for diagnostics at the end of each turn, iteration and run
+	diagnosticsReporters []DiagnosticsReporter
+	// flag which controls whether agent lifecycle hooks are invoked concurrently
+	parallelAgentHooks bool
+	// ordered phases making up each turn (empty if each turn is a single RunTurn)
+	turnPhases []TurnPhase[T]
+	// optional scheduler activating agents each turn (nil if agents are not activated)
+	scheduler Scheduler[T]
+	// agents activated during the last scheduled turn, in order of activation
+	activationOrder []uuid.UUID
+	activationLock  sync.Mutex
+	// conditions ending a run or iteration early
+	stopConditions []StopCondition[T]
+	// reason the last run ended early ("" if it ran every iteration)
+	stopReason string
+	// middleware wrapping every call to the game runner, outermost first
+	runnerMiddleware []RunnerMiddleware
+	// flag which controls whether agent IDs and message deliveries are reproducible
+	deterministic bool
+	// seed of the agent ID generator in deterministic mode
+	seed int64
+	// number of IDs drawn from the seeded generator, allowing its state to be restored
+	generatedIDs int
+	// seeded source of agent IDs in deterministic mode
+	idGenerator *rand.Rand
+	// seeded source of message IDs in deterministic mode, and the number drawn from it
+	messageIDGenerator  *rand.Rand
+	generatedMessageIDs int
+	// IDs from a restored snapshot, handed out to agents before any new IDs are generated
+	restoredIDs []uuid.UUID
+	// guards the ID generator against concurrent agent creation
+	idGeneratorLock sync.Mutex
+	// FIFO of asynchronous deliveries awaiting dispatch in deterministic mode
+	deliveryQueue *deliveryQueue[T]
+	// context of the run in progress, cancelled when the run is stopped
+	runCtx context.Context
+	// cancels the run in progress (nil between runs)
+	runCancel context.CancelFunc
+	// guards the run context against concurrent Stop calls and message sends
+	runLock sync.Mutex
+	// tracks asynchronous deliveries that have not yet been handled
+	inFlightDeliveries sync.WaitGroup
+	// number of iterations completed in the current run, from which a resumed run continues
+	completedIterations int
+	// optional destination for a snapshot written at the end of each iteration
+	checkpointWriter func(int) (io.WriteCloser, error)
+	// carries delivered messages to their recipients (in-process by default)
+	transport transport.Transport[T]
+	// map of agentid -> stream reaching agents which live in other processes
+	remoteAgents map[uuid.UUID]*transport.StreamTransport[T]
+	// IDs of remote agents, in order of announcement
+	remoteOrder []uuid.UUID
+	// number of remote agents, checked before looking up recipients on the messaging path
+	remoteAgentCount atomic.Int32
+	// streams to processes whose agents take part in this server's runs
+	remoteLinks []*transport.StreamTransport[T]
+	// stream to the shared server whose runs this server's agents take part in (nil if not joined)
+	sharedServer *transport.StreamTransport[T]
+	// guards the remote agents and streams
+	remoteLock sync.RWMutex
+	// iteration in progress, stamped onto new messages (-1 if outside a run)
+	currentIteration atomic.Int64
+	// turn in progress, stamped onto new messages (-1 if outside a turn)
+	currentTurn atomic.Int64
+	// time at which the turn in progress started, in Unix nanoseconds
+	turnStartTime atomic.Int64
+	// capacity of each agent's inbox in mailbox mode (0 if messages are handled on delivery)
+	mailboxCapacity int
+	// map of agentid -> inbox of delivered messages awaiting processing, in mailbox mode
+	mailboxes map[uuid.UUID]chan message.IMessage[T]
+	// guards the mailboxes against concurrent deliveries
+	mailboxLock sync.Mutex
+	// map of groupid -> group of agents for multicast messaging
+	groups map[uuid.UUID]*agentGroup
+	// guards the groups against concurrent membership changes
+	groupLock sync.RWMutex
+	// optional graph restricting which agents may message each other (nil if unrestricted)
+	topology *topology.Graph
+	// optional simulation of an unreliable network (nil if delivery is reliable and instant)
+	channelModel *network.ChannelModel
+	// destinations for the structured event log
+	eventSinks []events.EventSink
+	// guards the event sinks against registration during a run
+	eventSinkLock sync.RWMutex
+	// number of registered event sinks, checked before building events on the messaging path
+	eventSinkCount atomic.Int32
+	// optional log to which every delivery is written (nil if not recording)
+	recorder *deliveryRecorder[T]
+	// state of a replay in progress (nil if not replaying)
+	replay *replaySession[T]
+	// guards the recorder and replay state
+	replayLock sync.RWMutex
+	// whether deliveries are being recorded, checked before tracking handlers on the messaging path
+	recording atomic.Bool
+	// map of agentid -> number of messages the agent is handling, identifying messages produced by handlers
+	handling     map[uuid.UUID]int
+	handlingLock sync.Mutex
+	// destinations for the diagnostics history, written at the end of each run (nil if not exported)
+	diagnosticsCSVWriter  io.Writer
+	diagnosticsJSONWriter io.Writer
+	// optional registry naming message types in diagnostics (nil to use reflected names)
+	messageTypeRegistry *message.CodecRegistry[T]
 }
 
+// logs messaging diagnostics to the console at the end of each turn. Further destinations,
+// and iteration and run summaries, can be added with AddDiagnosticsReporter
 func (server *BaseServer[T]) ReportMessagingDiagnostics() {
 	server.reportMessagingDiagnostics = true
 }
@@ -43,76 +167,373 @@ func (server *BaseServer[T]) ReportMessagingDiagnostics() {
 func (server *BaseServer[T]) handleStartOfTurn() {
 	server.agentFinishedMessaging = make(chan uuid.UUID)
 	server.endNotifyAgentDone = make(chan struct{})
+	server.turnStartTime.Store(time.Now().UnixNano())
+	server.sessionOpen = true
 }
 
 func (serv *BaseServer[T]) endAgentListeningSession() bool {
+	return serv.endMessagingSession(serv.turnTimeout)
+}
+
+// waits up to the timeout for every agent to signal messaging complete, then closes the session
+func (serv *BaseServer[T]) endMessagingSession(timeout time.Duration) bool {
 	status := true
-	ctx, cancel := context.WithTimeout(context.Background(), serv.turnTimeout)
+	ctx, cancel := context.WithTimeout(serv.runContext(), timeout)
 	defer cancel()
+	if serv.deterministic {
+		serv.deliveryQueue.drain(ctx, serv.deliverMessage, func(msg message.IMessage[T], recipient uuid.UUID, produced bool) {
+			serv.emitMessageEvent(events.MessageDropped, msg, recipient, events.DropSessionEnd)
+			serv.recordDrop(msg, recipient, produced)
+		})
+	}
 	agentStoppedTalkingMap := make(map[uuid.UUID]struct{})
+	numAgents := len(serv.agentMap) + int(serv.remoteAgentCount.Load())
 awaitSessionEnd:
-	for len(agentStoppedTalkingMap) != len(serv.agentMap) {
+	for len(agentStoppedTalkingMap) != numAgents {
 		select {
 		case id := <-serv.agentFinishedMessaging:
 			agentStoppedTalkingMap[id] = struct{}{}
+			serv.emitAgentEvent(events.MessagingComplete, id)
 		case <-ctx.Done():
 			status = false
+			serv.EmitEvent(events.Event{
+				Type:   events.MessagingTimeout,
+				Detail: fmt.Sprintf("%d of %d agents finished messaging", len(agentStoppedTalkingMap), numAgents),
+			})
 			break awaitSessionEnd
 		}
 	}
 	serv.diagnosticsEngine.ReportEndMessagingStatus(len(agentStoppedTalkingMap))
 	close(serv.endNotifyAgentDone)
+	serv.sessionOpen = false
+	serv.turnMessagingComplete = serv.turnMessagingComplete && status
 	return status
 }
 
-func (server *BaseServer[T]) reportDiagnostics() {
-	msgSuccessRate := server.diagnosticsEngine.GetMessagingSuccessRate()
-	numMsgSuccess := server.diagnosticsEngine.GetNumberMessageSuccesses()
-	numMsgDrops := server.diagnosticsEngine.GetNumberMessageDrops()
-	fmt.Printf("%f%% of messages successfully sent (%d delivered, %d dropped)\n", msgSuccessRate, numMsgSuccess, numMsgDrops)
-	numAgents := len(server.GetAgentMap())
-	numEndMsg := server.diagnosticsEngine.GetNumberEndMessagings()
-	endMsgSuccess := server.diagnosticsEngine.GetEndMessagingSuccessRate(numAgents)
-	fmt.Printf("%f%% of agents successfully ended messaging (%d ended, %d total)\n", endMsgSuccess, numEndMsg, numAgents)
-
-}
-
 func (server *BaseServer[T]) handleEndOfTurn() {
 	server.endAgentListeningSession()
-	if server.reportMessagingDiagnostics {
-		server.reportDiagnostics()
+	server.recordTurnDiagnostics()
+}
+
+// reports and archives the turn's diagnostics, then resets them for the next turn
+func (server *BaseServer[T]) recordTurnDiagnostics() {
+	iteration, turn := server.GetCurrentIteration(), server.GetCurrentTurn()
+	server.reportTurnDiagnostics(server.diagnosticsEngine.GetRoundRecord(iteration, turn))
+	if iteration >= 0 {
+		server.diagnosticsEngine.RecordRoundDiagnostics(iteration, turn)
 	}
 	server.diagnosticsEngine.ResetRoundDiagnostics()
 }
 
 func (server *BaseServer[T]) DeliverMessage(msg message.IMessage[T], recipient uuid.UUID) {
-	msg.InvokeMessageHandler(server.agentMap[recipient])
+	server.deliverMessage(msg, recipient, server.isHandling(msg.GetSender()))
+}
+
+// delivers a message, noting whether its sender produced it while handling an earlier delivery
+func (server *BaseServer[T]) deliverMessage(msg message.IMessage[T], recipient uuid.UUID, produced bool) {
+	if session := server.replaySession(); session != nil {
+		session.checkProduced(msg, recipient)
+		return
+	}
+	if reason := server.expiryReason(msg); reason != "" {
+		server.emitMessageEvent(events.MessageDropped, msg, recipient, reason)
+		server.recordDrop(msg, recipient, produced)
+		return
+	}
+	if metadata, ok := msg.(message.IMessageMetadata); ok && !metadata.GetSentAt().IsZero() {
+		server.diagnosticsEngine.ReportDeliveryLatency(time.Since(metadata.GetSentAt()))
+	}
+	server.recordDelivery(msg, recipient, produced)
+	server.deliver(msg, recipient)
+}
+
+// returns why a message may no longer be delivered ("" if it may). Messages sent during a turn
+// are stale once it has ended; wall-clock TTLs are not reproducible, so only apply outside deterministic mode
+func (server *BaseServer[T]) expiryReason(msg message.IMessage[T]) string {
+	metadata, ok := msg.(message.IMessageMetadata)
+	if !ok {
+		return ""
+	}
+	if metadata.IsStale(server.GetCurrentIteration(), server.GetCurrentTurn()) {
+		return events.DropStale
+	}
+	if !server.deterministic && metadata.IsExpired(time.Now()) {
+		return events.DropExpired
+	}
+	return ""
+}
+
+// hands a message to its recipient, resolving pending requests and respecting mailbox mode
+func (server *BaseServer[T]) deliver(msg message.IMessage[T], recipient uuid.UUID) {
+	if stream := server.remoteStream(recipient); stream != nil {
+		stream.Deliver(msg, recipient)
+		server.emitMessageEvent(events.MessageDelivered, msg, recipient, "")
+		return
+	}
+	if ag, ok := server.agentMap[recipient]; ok && ag.ResolveReply(msg) {
+		server.emitMessageEvent(events.MessageDelivered, msg, recipient, "")
+		return
+	}
+	_, local := server.agentMap[recipient]
+	if local {
+		if inbox := server.mailbox(recipient); inbox != nil {
+			server.postToMailbox(inbox, msg, recipient)
+			return
+		}
+	}
+	// handlers are only tracked to attribute the messages they produce in a recording
+	if local && server.recording.Load() {
+		server.beginHandling(recipient)
+		defer server.endHandling(recipient)
+	}
+	handlingStarted := time.Now()
+	server.transport.Deliver(msg, recipient)
+	if local {
+		server.diagnosticsEngine.ReportHandlerDuration(recipient, time.Since(handlingStarted))
+	}
+	server.emitMessageEvent(events.MessageDelivered, msg, recipient, "")
+}
+
+// replaces the transport carrying delivered messages to agents added to the server. Agents in
+// other processes take part in runs through ServeRemoteAgents, which reaches them over a stream
+func (server *BaseServer[T]) SetTransport(messageTransport transport.Transport[T]) {
+	server.transport = messageTransport
+}
+
+func (server *BaseServer[T]) ScheduleMessageDelivery(msg message.IMessage[T], recipient uuid.UUID, onDelivered func()) {
+	if session := server.replaySession(); session != nil {
+		session.checkProduced(msg, recipient)
+		onDelivered()
+		return
+	}
+	produced := server.isHandling(msg.GetSender())
+	delays := server.sampleChannel(msg.GetSender(), recipient)
+	if server.deterministic {
+		server.deliveryQueue.hold(onDelivered)
+	}
+	if len(delays) == 0 {
+		server.emitMessageEvent(events.MessageDropped, msg, recipient, events.DropNetworkLoss)
+		server.recordDrop(msg, recipient, produced)
+		if !server.deterministic {
+			onDelivered()
+		}
+		return
+	}
+	// duplicates introduced by the channel model are not attributed to the sender's handler,
+	// as a replay (which bypasses the channel model) only produces the message once
+	if server.deterministic {
+		for k := range delays {
+			server.deliveryQueue.push(msg, recipient, produced && k == 0)
+		}
+		return
+	}
+	ctx := server.runContext()
+	server.inFlightDeliveries.Add(1)
+	go func() {
+		defer server.inFlightDeliveries.Done()
+		// bandwidth limits messages being handled, not messages in transit, so it is freed before any delay
+		release := sync.OnceFunc(onDelivered)
+		defer release()
+		elapsed := time.Duration(0)
+		for k, delay := range delays {
+			if delay > elapsed {
+				release()
+			}
+			if !sleepWithContext(ctx, delay-elapsed) {
+				break
+			}
+			elapsed = delay
+			server.deliverMessage(msg, recipient, produced && k == 0)
+		}
+	}()
 }
 
 func (serv *BaseServer[T]) AddAgent(agent T) {
+	_, exists := serv.agentMap[agent.GetID()]
 	serv.agentMap[agent.GetID()] = agent
 	serv.agentIdSet[agent.GetID()] = struct{}{}
+	if exists {
+		return
+	}
+	serv.agentOrder = append(serv.agentOrder, agent.GetID())
+	serv.agentCount.Add(1)
+	serv.emitAgentEvent(events.AgentAdded, agent.GetID())
+	serv.notifyAdded(agent)
 }
 
 func (serv *BaseServer[T]) ViewAgentIdSet() map[uuid.UUID]struct{} {
 	return serv.agentIdSet
 }
 
+// safe to call concurrently with a run, unlike ViewAgentIdSet
+func (serv *BaseServer[T]) GetAgentCount() int {
+	return int(serv.agentCount.Load())
+}
+
+func (serv *BaseServer[T]) ViewOrderedAgentIds() []uuid.UUID {
+	return slices.Clone(serv.agentOrder)
+}
+
+// restricts messaging to agents connected in the graph (nil lifts the restriction)
+func (serv *BaseServer[T]) SetTopology(graph *topology.Graph) {
+	serv.topology = graph
+}
+
+func (serv *BaseServer[T]) GetTopology() *topology.Graph {
+	return serv.topology
+}
+
+func (serv *BaseServer[T]) CanMessage(sender, recipient uuid.UUID) bool {
+	return serv.topology == nil || serv.topology.AreNeighbours(sender, recipient)
+}
+
+func (serv *BaseServer[T]) ViewNeighbours(id uuid.UUID) []uuid.UUID {
+	if serv.topology != nil {
+		return serv.topology.Neighbours(id)
+	}
+	return append(serv.ViewOrderedAgentIds(), serv.viewRemoteAgentIds()...)
+}
+
 func (serv *BaseServer[T]) AccessAgentByID(id uuid.UUID) T {
 	return serv.agentMap[id]
 }
 
-func (serv *BaseServer[T]) Start() {
+// runs the simulation, returning its outcome
+func (serv *BaseServer[T]) Start() RunResult {
+	result, _ := serv.StartWithContext(context.Background())
+	return result
+}
+
+// runs the simulation, returning its outcome. The error, also recorded in the result, is a
+// RunHaltedError if the context is cancelled, or wraps the first error returned by the game runner
+func (serv *BaseServer[T]) StartWithContext(ctx context.Context) (RunResult, error) {
 	serv.checkGameRunner()
-	for i := 0; i < serv.iterations; i++ {
-		serv.gameRunner.RunStartOfIteration(i)
+	ctx = serv.beginRun(ctx)
+	defer serv.endRun()
+	if serv.completedIterations >= serv.iterations {
+		serv.completedIterations = 0
+	}
+	if serv.completedIterations == 0 {
+		serv.diagnosticsEngine.ClearHistory()
+	}
+	serv.stopReason = ""
+	result := RunResult{Turns: []TurnStatus{}}
+	err := serv.runIterations(ctx, serv.wrappedGameRunner(), &result)
+	serv.reportRunDiagnostics()
+	err = errors.Join(err, serv.exportDiagnosticsHistory())
+	result.StopReason = serv.stopReason
+	result.Err = err
+	return result, err
+}
+
+func (serv *BaseServer[T]) runIterations(ctx context.Context, runner FallibleGameRunner, result *RunResult) error {
+	for i := serv.completedIterations; i < serv.iterations; i++ {
+		if ctx.Err() != nil {
+			return &RunHaltedError{Iteration: i, Turn: -1, Cause: ctx.Err()}
+		}
+		serv.setCurrentTurnStamp(i, -1)
+		serv.EmitEvent(events.Event{Type: events.IterationStarted})
+		serv.notifyIterationStart(i)
+		if err := runner.RunStartOfIteration(i); err != nil {
+			return fmt.Errorf("start of iteration %d failed: %w", i, err)
+		}
 		for j := 0; j < serv.turns; j++ {
-			serv.handleStartOfTurn()
-			serv.gameRunner.RunTurn(i, j)
-			serv.handleEndOfTurn()
+			if ctx.Err() != nil {
+				return &RunHaltedError{Iteration: i, Turn: j, Cause: ctx.Err()}
+			}
+			status, err := serv.runFullTurn(ctx, runner, i, j)
+			result.Turns = append(result.Turns, status)
+			if err != nil {
+				return err
+			}
+			if ctx.Err() != nil {
+				return &RunHaltedError{Iteration: i, Turn: j, Cause: ctx.Err()}
+			}
+			if condition := serv.checkStopConditions(true); condition != nil {
+				if condition.IterationOnly {
+					if result.IterationStopReasons == nil {
+						result.IterationStopReasons = map[int]string{}
+					}
+					result.IterationStopReasons[i] = condition.Reason
+				}
+				break
+			}
+		}
+		serv.setCurrentTurnStamp(i, -1)
+		if err := runner.RunEndOfIteration(i); err != nil {
+			return fmt.Errorf("end of iteration %d failed: %w", i, err)
+		}
+		serv.notifyIterationEnd(i)
+		serv.reportIterationDiagnostics(i)
+		serv.EmitEvent(events.Event{Type: events.IterationEnded})
+		serv.completedIterations = i + 1
+		result.CompletedIterations++
+		stopped := serv.stopReason != "" || serv.checkStopConditions(false) != nil
+		if stopped {
+			serv.completedIterations = serv.iterations
+		}
+		if err := serv.writeCheckpoint(i); err != nil {
+			return err
+		}
+		if stopped {
+			break
+		}
+	}
+	return nil
+}
+
+// runs a single turn, from opening its messaging session to recording its diagnostics
+func (serv *BaseServer[T]) runFullTurn(ctx context.Context, runner FallibleGameRunner, iteration, turn int) (TurnStatus, error) {
+	status := TurnStatus{Iteration: iteration, Turn: turn}
+	serv.setCurrentTurnStamp(iteration, turn)
+	serv.handleStartOfTurn()
+	serv.EmitEvent(events.Event{Type: events.TurnStarted})
+	serv.notifyTurnStart(iteration, turn)
+	serv.scheduleAgents(iteration, turn)
+	serv.turnMessagingComplete = true
+	err := runner.RunTurn(ctx, iteration, turn)
+	var halted *RunHaltedError
+	if err != nil && !errors.As(err, &halted) {
+		err = fmt.Errorf("turn %d of iteration %d failed: %w", turn, iteration, err)
+	}
+	// a phased turn ends its own sessions, unless a phase failed before reaching the end of one
+	if serv.sessionOpen {
+		serv.endAgentListeningSession()
+	}
+	status.MessagingComplete = serv.turnMessagingComplete
+	status.AgentsFinishedMessaging = serv.diagnosticsEngine.GetNumberEndMessagings()
+	serv.recordTurnDiagnostics()
+	if err != nil {
+		return status, err
+	}
+	status.Completed = true
+	serv.notifyTurnEnd(iteration, turn)
+	serv.EmitEvent(events.Event{Type: events.TurnEnded})
+	return status, nil
+}
+
+// registers a destination for the per-turn diagnostics history, written as CSV at the end of each run
+func (serv *BaseServer[T]) SetDiagnosticsCSVWriter(w io.Writer) {
+	serv.diagnosticsCSVWriter = w
+}
+
+// registers a destination for the per-turn diagnostics history and its summary, written as JSON at the end of each run
+func (serv *BaseServer[T]) SetDiagnosticsJSONWriter(w io.Writer) {
+	serv.diagnosticsJSONWriter = w
+}
+
+func (serv *BaseServer[T]) exportDiagnosticsHistory() error {
+	if serv.diagnosticsCSVWriter != nil {
+		if err := serv.diagnosticsEngine.ExportHistoryCSV(serv.diagnosticsCSVWriter); err != nil {
+			return fmt.Errorf("unable to export diagnostics history as CSV: %w", err)
 		}
-		serv.gameRunner.RunEndOfIteration(i)
 	}
+	if serv.diagnosticsJSONWriter != nil {
+		if err := serv.diagnosticsEngine.ExportHistoryJSON(serv.diagnosticsJSONWriter); err != nil {
+			return fmt.Errorf("unable to export diagnostics history as JSON: %w", err)
+		}
+	}
+	return nil
 }
 
 func (serv *BaseServer[T]) GetAgentMap() map[uuid.UUID]T {
@@ -120,8 +541,14 @@ func (serv *BaseServer[T]) GetAgentMap() map[uuid.UUID]T {
 }
 
 func (serv *BaseServer[T]) AgentStoppedTalking(id uuid.UUID) {
+	if shared := serv.sharedServerStream(); shared != nil {
+		shared.SignalMessagingComplete(id)
+		return
+	}
+	elapsed := time.Since(time.Unix(0, serv.turnStartTime.Load()))
 	select {
 	case serv.agentFinishedMessaging <- id:
+		serv.diagnosticsEngine.ReportMessagingCompleteTime(id, elapsed)
 		return
 	case <-serv.endNotifyAgentDone:
 		return
@@ -129,7 +556,12 @@ func (serv *BaseServer[T]) AgentStoppedTalking(id uuid.UUID) {
 }
 
 func (serv *BaseServer[T]) SetGameRunner(handler GameRunner) {
-	serv.gameRunner = handler
+	serv.gameRunner = AdaptGameRunner(handler)
+}
+
+// injects a game runner whose errors halt the run and are recorded in its result
+func (serv *BaseServer[T]) SetFallibleGameRunner(runner FallibleGameRunner) {
+	serv.gameRunner = runner
 }
 
 func (serv *BaseServer[T]) checkGameRunner() {
@@ -150,6 +582,19 @@ func (serv *BaseServer[T]) RunEndOfIteration(iteration int) {
 	panic("RunEndOfIteration not defined in server.")
 }
 
+func (serv *BaseServer[T]) GetCurrentIteration() int {
+	return int(serv.currentIteration.Load())
+}
+
+func (serv *BaseServer[T]) GetCurrentTurn() int {
+	return int(serv.currentTurn.Load())
+}
+
+func (serv *BaseServer[T]) setCurrentTurnStamp(iteration, turn int) {
+	serv.currentIteration.Store(int64(iteration))
+	serv.currentTurn.Store(int64(turn))
+}
+
 func (serv *BaseServer[T]) GetTurns() int {
 	return serv.turns
 }
@@ -159,8 +604,22 @@ func (serv *BaseServer[T]) GetIterations() int {
 }
 
 func (serv *BaseServer[T]) RemoveAgent(agentToRemove T) {
+	_, exists := serv.agentMap[agentToRemove.GetID()]
 	delete(serv.agentMap, agentToRemove.GetID())
 	delete(serv.agentIdSet, agentToRemove.GetID())
+	serv.deleteMailbox(agentToRemove.GetID())
+	serv.leaveAllGroups(agentToRemove.GetID())
+	if serv.topology != nil {
+		serv.topology.RemoveNode(agentToRemove.GetID())
+	}
+	serv.emitAgentEvent(events.AgentRemoved, agentToRemove.GetID())
+	serv.agentOrder = slices.DeleteFunc(serv.agentOrder, func(id uuid.UUID) bool {
+		return id == agentToRemove.GetID()
+	})
+	if exists {
+		serv.agentCount.Add(-1)
+		serv.notifyRemoved(agentToRemove)
+	}
 }
 
 func (serv *BaseServer[T]) GetAgentMessagingBandwidth() int {
@@ -171,19 +630,45 @@ func (serv *BaseServer[T]) GetDiagnosticEngine() diagnosticsEngine.IDiagnosticsE
 	return serv.diagnosticsEngine
 }
 
+// reports message types in diagnostics under their registered names, rather than their Go type names
+func (serv *BaseServer[T]) SetMessageTypeRegistry(registry *message.CodecRegistry[T]) {
+	serv.messageTypeRegistry = registry
+}
+
+func (serv *BaseServer[T]) GetMessageTypeName(msg message.IMessage[T]) string {
+	if serv.messageTypeRegistry != nil {
+		if name, ok := serv.messageTypeRegistry.TypeName(msg); ok {
+			return name
+		}
+	}
+	return events.MessageTypeName(msg)
+}
+
 // generate a server instance based on a mapping function and number of iterations
 func CreateBaseServer[T agent.IAgent[T]](iterations, turns int, turnMaxDuration time.Duration, messageBandwidth int) *BaseServer[T] {
-	return &BaseServer[T]{
-		agentMap:                   make(map[uuid.UUID]T),
-		agentIdSet:                 make(map[uuid.UUID]struct{}),
-		turnTimeout:                turnMaxDuration,
-		gameRunner:                 nil,
-		iterations:                 iterations,
-		turns:                      turns,
-		agentFinishedMessaging:     make(chan uuid.UUID),
-		endNotifyAgentDone:         make(chan struct{}),
-		agentMessagingBandwidth:    messageBandwidth,
-		diagnosticsEngine:          diagnosticsEngine.CreateDiagnosticsEngine(),
-		reportMessagingDiagnostics: false,
+	serv := &BaseServer[T]{
+		agentMap:                make(map[uuid.UUID]T),
+		agentIdSet:              make(map[uuid.UUID]struct{}),
+		agentOrder:              []uuid.UUID{},
+		turnTimeout:             turnMaxDuration,
+		gameRunner:              nil,
+		iterations:              iterations,
+		turns:                   turns,
+		agentFinishedMessaging:  make(chan uuid.UUID),
+		endNotifyAgentDone:      make(chan struct{}),
+		agentMessagingBandwidth: messageBandwidth,
+		diagnosticsEngine:       diagnosticsEngine.CreateDiagnosticsEngine(),
+		deterministic:           false,
+		idGenerator:             nil,
+		deliveryQueue:           &deliveryQueue[T]{},
+		runCtx:                  context.Background(),
+		runCancel:               nil,
+		groups:                  make(map[uuid.UUID]*agentGroup),
+		handling:                make(map[uuid.UUID]int),
+		remoteAgents:            make(map[uuid.UUID]*transport.StreamTransport[T]),
+		consoleWriter:           os.Stdout,
 	}
+	serv.transport = transport.CreateInMemoryTransport(serv.AccessAgentByID)
+	serv.setCurrentTurnStamp(-1, -1)
+	return serv
 }
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/MattSScott/basePlatformSOMAS/v2/internal/diagnosticsEngine"
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/network"
+	"github.com/google/uuid"
+)
+
+// simulates an unreliable network for messages sent with SendMessage (nil for reliable, instant delivery).
+// In deterministic mode, losses and duplicates are simulated but latency and reordering are not
+func (server *BaseServer[T]) SetChannelModel(model *network.ChannelModel) {
+	server.channelModel = model
+}
+
+// returns the delay before each copy of a message is delivered (empty if the message is lost),
+// reporting any network effects to the diagnostics engine. In deterministic mode, delays are
+// discarded, so neither delay nor the reordering it causes is reported
+func (server *BaseServer[T]) sampleChannel(sender, recipient uuid.UUID) []time.Duration {
+	if server.channelModel == nil {
+		return []time.Duration{0}
+	}
+	fate := server.channelModel.Sample(sender, recipient)
+	effects := map[diagnosticsEngine.NetworkEffect]bool{
+		diagnosticsEngine.NetworkLoss:        fate.Lost,
+		diagnosticsEngine.NetworkDuplication: fate.Duplicated,
+		diagnosticsEngine.NetworkReordering:  fate.Reordered && !server.deterministic,
+		diagnosticsEngine.NetworkDelay:       fate.Delayed && !server.deterministic,
+	}
+	for effect, occurred := range effects {
+		if occurred {
+			server.diagnosticsEngine.ReportNetworkEffect(effect)
+		}
+	}
+	return fate.Delays
+}
+
+// waits for the duration, returning false if the context ends first
+func sleepWithContext(ctx context.Context, duration time.Duration) bool {
+	if duration <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/message"
+	"github.com/google/uuid"
+)
+
+// a message awaiting asynchronous delivery
+type pendingDelivery[T any] struct {
+	msg       message.IMessage[T]
+	recipient uuid.UUID
+	// whether the sender produced the message while handling an earlier delivery
+	produced bool
+}
+
+// FIFO of asynchronous deliveries, dispatched by a single goroutine in deterministic mode
+type deliveryQueue[T any] struct {
+	lock    sync.Mutex
+	pending []pendingDelivery[T]
+	// frees the bandwidth of each message sent since the last messaging session ended
+	releases []func()
+}
+
+func (dq *deliveryQueue[T]) push(msg message.IMessage[T], recipient uuid.UUID, produced bool) {
+	dq.lock.Lock()
+	defer dq.lock.Unlock()
+	dq.pending = append(dq.pending, pendingDelivery[T]{msg, recipient, produced})
+}
+
+// holds a sender's bandwidth for a message until the end of the messaging session
+func (dq *deliveryQueue[T]) hold(release func()) {
+	dq.lock.Lock()
+	defer dq.lock.Unlock()
+	dq.releases = append(dq.releases, release)
+}
+
+func (dq *deliveryQueue[T]) pop() (pendingDelivery[T], bool) {
+	dq.lock.Lock()
+	defer dq.lock.Unlock()
+	if len(dq.pending) == 0 {
+		return pendingDelivery[T]{}, false
+	}
+	next := dq.pending[0]
+	dq.pending = dq.pending[1:]
+	return next, true
+}
+
+// delivers queued messages in send order (including any sent by handlers) until the queue
+// empties or the context expires, at which point undelivered messages are discarded. Bandwidth
+// held by the session's messages is then freed
+func (dq *deliveryQueue[T]) drain(ctx context.Context, deliver, discard func(message.IMessage[T], uuid.UUID, bool)) {
+	for {
+		next, ok := dq.pop()
+		if !ok {
+			break
+		}
+		if ctx.Err() == nil {
+			deliver(next.msg, next.recipient, next.produced)
+		} else {
+			discard(next.msg, next.recipient, next.produced)
+		}
+	}
+	dq.lock.Lock()
+	releases := dq.releases
+	dq.releases = nil
+	dq.lock.Unlock()
+	for _, release := range releases {
+		release()
+	}
+}
+
+// offsets the seed of the message ID generator, so that message IDs do not repeat agent IDs
+const messageIDSeedOffset = 1 << 32
+
+// seeds agent and message IDs and serialises asynchronous message deliveries, so that a run with a
+// given seed and a sequential GameRunner is reproducible. Must be called before agents are created.
+// In this mode, messages sent with SendMessage are queued and delivered in send order
+// during the messaging session at the end of each turn, and replies to a Request only arrive
+// once the session begins. Rather than limiting messages in flight at once, bandwidth becomes a
+// quota of messages each agent may send per messaging session (including those sent by its
+// handlers during the session), so that messages beyond it are dropped reproducibly.
+func (server *BaseServer[T]) EnableDeterministicMode(seed int64) {
+	server.idGeneratorLock.Lock()
+	defer server.idGeneratorLock.Unlock()
+	server.deterministic = true
+	server.seedGenerators(seed)
+}
+
+// must be called with the ID generator lock held
+func (server *BaseServer[T]) seedGenerators(seed int64) {
+	server.seed = seed
+	server.generatedIDs = 0
+	server.generatedMessageIDs = 0
+	server.idGenerator = rand.New(rand.NewSource(seed))
+	server.messageIDGenerator = rand.New(rand.NewSource(seed + messageIDSeedOffset))
+}
+
+func (server *BaseServer[T]) GenerateAgentID() uuid.UUID {
+	server.idGeneratorLock.Lock()
+	defer server.idGeneratorLock.Unlock()
+	if len(server.restoredIDs) > 0 {
+		id := server.restoredIDs[0]
+		server.restoredIDs = server.restoredIDs[1:]
+		return id
+	}
+	if !server.deterministic {
+		return uuid.New()
+	}
+	return server.nextSeededID()
+}
+
+func (server *BaseServer[T]) GenerateMessageID() uuid.UUID {
+	server.idGeneratorLock.Lock()
+	defer server.idGeneratorLock.Unlock()
+	if !server.deterministic {
+		return uuid.New()
+	}
+	return server.nextSeededMessageID()
+}
+
+// group IDs share the seeded agent ID sequence, so that groups created during setup are reproducible
+func (server *BaseServer[T]) generateGroupID() uuid.UUID {
+	server.idGeneratorLock.Lock()
+	defer server.idGeneratorLock.Unlock()
+	if !server.deterministic {
+		return uuid.New()
+	}
+	return server.nextSeededID()
+}
+
+// must be called with the ID generator lock held
+func (server *BaseServer[T]) nextSeededID() uuid.UUID {
+	id, err := uuid.NewRandomFromReader(server.idGenerator)
+	if err != nil {
+		panic("Unable to generate agent ID from seeded source: " + err.Error())
+	}
+	server.generatedIDs++
+	return id
+}
+
+// must be called with the ID generator lock held
+func (server *BaseServer[T]) nextSeededMessageID() uuid.UUID {
+	id, err := uuid.NewRandomFromReader(server.messageIDGenerator)
+	if err != nil {
+		panic("Unable to generate message ID from seeded source: " + err.Error())
+	}
+	server.generatedMessageIDs++
+	return id
+}
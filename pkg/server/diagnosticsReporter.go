@@ -0,0 +1,220 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+
+	"github.com/MattSScott/basePlatformSOMAS/v2/internal/diagnosticsEngine"
+)
+
+// messaging diagnostics of a single turn
+type TurnRecord = diagnosticsEngine.TurnRecord
+
+// aggregate messaging diagnostics of a run
+type HistorySummary = diagnosticsEngine.HistorySummary
+
+// read access to the diagnostics engine, including per-agent breakdowns and timings
+type DiagnosticsData = diagnosticsEngine.IDiagnosticsEngine
+
+// receives messaging diagnostics as the simulation progresses
+type DiagnosticsReporter interface {
+	// called at the end of each turn, before the round's diagnostics are reset
+	ReportTurn(record TurnRecord, numAgents int, data DiagnosticsData)
+	// called at the end of each iteration with the records of its turns
+	ReportIteration(iteration int, turns []TurnRecord)
+	// called at the end of each run, including runs which halted early
+	ReportRun(summary HistorySummary)
+}
+
+// registers a reporter to receive diagnostics. Several reporters may be registered
+func (serv *BaseServer[T]) AddDiagnosticsReporter(reporter DiagnosticsReporter) {
+	serv.diagnosticsReporters = append(serv.diagnosticsReporters, reporter)
+}
+
+func (serv *BaseServer[T]) reportTurnDiagnostics(record TurnRecord) {
+	if serv.reportMessagingDiagnostics {
+		CreateConsoleReporter(serv.consoleWriter).ReportTurn(record, len(serv.agentMap), serv.diagnosticsEngine)
+	}
+	for _, reporter := range serv.diagnosticsReporters {
+		reporter.ReportTurn(record, len(serv.agentMap), serv.diagnosticsEngine)
+	}
+}
+
+func (serv *BaseServer[T]) reportIterationDiagnostics(iteration int) {
+	if len(serv.diagnosticsReporters) == 0 {
+		return
+	}
+	turns := serv.diagnosticsEngine.GetIterationHistory(iteration)
+	for _, reporter := range serv.diagnosticsReporters {
+		reporter.ReportIteration(iteration, turns)
+	}
+}
+
+func (serv *BaseServer[T]) reportRunDiagnostics() {
+	if len(serv.diagnosticsReporters) == 0 {
+		return
+	}
+	summary := serv.diagnosticsEngine.GetHistorySummary()
+	for _, reporter := range serv.diagnosticsReporters {
+		reporter.ReportRun(summary)
+	}
+}
+
+func sumTurns(turns []TurnRecord) (sent, delivered, dropped int) {
+	for _, record := range turns {
+		sent += record.Sent
+		delivered += record.Delivered
+		dropped += record.Dropped
+	}
+	return sent, delivered, dropped
+}
+
+// writes human-readable diagnostics of each turn, in the format logged by ReportMessagingDiagnostics
+type ConsoleReporter struct {
+	w io.Writer
+}
+
+func CreateConsoleReporter(w io.Writer) *ConsoleReporter {
+	return &ConsoleReporter{w: w}
+}
+
+func (cr *ConsoleReporter) ReportTurn(record TurnRecord, numAgents int, data DiagnosticsData) {
+	fmt.Fprintf(cr.w, "%f%% of messages successfully sent (%d delivered, %d dropped)\n", data.GetMessagingSuccessRate(), record.Delivered, record.Dropped)
+	fmt.Fprintf(cr.w, "%f%% of agents successfully ended messaging (%d ended, %d total)\n", data.GetEndMessagingSuccessRate(numAgents), record.EndMessagings, numAgents)
+}
+
+// iterations and runs are summarised by SummaryReporter
+func (cr *ConsoleReporter) ReportIteration(iteration int, turns []TurnRecord) {}
+
+func (cr *ConsoleReporter) ReportRun(summary HistorySummary) {}
+
+// writes a human-readable summary of each iteration and run
+type SummaryReporter struct {
+	w io.Writer
+}
+
+func CreateSummaryReporter(w io.Writer) *SummaryReporter {
+	return &SummaryReporter{w: w}
+}
+
+func (sr *SummaryReporter) ReportTurn(record TurnRecord, numAgents int, data DiagnosticsData) {}
+
+func (sr *SummaryReporter) ReportIteration(iteration int, turns []TurnRecord) {
+	sent, delivered, dropped := sumTurns(turns)
+	fmt.Fprintf(sr.w, "iteration %d: %d messages sent over %d turns (%d delivered, %d dropped)\n", iteration, sent, len(turns), delivered, dropped)
+}
+
+func (sr *SummaryReporter) ReportRun(summary HistorySummary) {
+	fmt.Fprintf(sr.w, "run: %d messages sent over %d turns (%d delivered, %d dropped); worst turn %d of iteration %d dropped %d\n",
+		summary.TotalSent, summary.Turns, summary.TotalDelivered, summary.TotalDropped,
+		summary.WorstTurn.Turn, summary.WorstTurn.Iteration, summary.WorstTurn.Dropped)
+}
+
+// a line written by the JSON reporter
+type jsonReport struct {
+	// "turn", "iteration" or "run"
+	Scope     string          `json:"scope"`
+	Iteration *int            `json:"iteration,omitempty"`
+	Agents    *int            `json:"agents,omitempty"`
+	Turn      *TurnRecord     `json:"turn,omitempty"`
+	Turns     []TurnRecord    `json:"turns,omitempty"`
+	Summary   *HistorySummary `json:"summary,omitempty"`
+}
+
+// writes each report as a line of JSON, distinguished by its scope
+type JSONReporter struct {
+	lock    sync.Mutex
+	encoder *json.Encoder
+	// first error encountered while writing, after which reports are discarded
+	err error
+}
+
+func CreateJSONReporter(w io.Writer) *JSONReporter {
+	return &JSONReporter{encoder: json.NewEncoder(w)}
+}
+
+func (jr *JSONReporter) write(report jsonReport) {
+	jr.lock.Lock()
+	defer jr.lock.Unlock()
+	if jr.err != nil {
+		return
+	}
+	jr.err = jr.encoder.Encode(report)
+}
+
+// returns the first error encountered while writing reports
+func (jr *JSONReporter) Err() error {
+	jr.lock.Lock()
+	defer jr.lock.Unlock()
+	return jr.err
+}
+
+func (jr *JSONReporter) ReportTurn(record TurnRecord, numAgents int, data DiagnosticsData) {
+	jr.write(jsonReport{Scope: "turn", Agents: &numAgents, Turn: &record})
+}
+
+func (jr *JSONReporter) ReportIteration(iteration int, turns []TurnRecord) {
+	jr.write(jsonReport{Scope: "iteration", Iteration: &iteration, Turns: turns})
+}
+
+func (jr *JSONReporter) ReportRun(summary HistorySummary) {
+	jr.write(jsonReport{Scope: "run", Summary: &summary})
+}
+
+var diagnosticsCSVHeader = []string{"scope", "iteration", "turn", "agents", "sent", "delivered", "dropped", "endMessagings"}
+
+// writes one CSV row per turn, followed by totals rows for each iteration and the run.
+// Fields which do not apply to a row are left empty
+type CSVReporter struct {
+	lock          sync.Mutex
+	writer        *csv.Writer
+	headerWritten bool
+	// first error encountered while writing, after which reports are discarded
+	err error
+}
+
+func CreateCSVReporter(w io.Writer) *CSVReporter {
+	return &CSVReporter{writer: csv.NewWriter(w)}
+}
+
+func (cr *CSVReporter) write(row []string) {
+	cr.lock.Lock()
+	defer cr.lock.Unlock()
+	if cr.err != nil {
+		return
+	}
+	if !cr.headerWritten {
+		cr.writer.Write(diagnosticsCSVHeader)
+		cr.headerWritten = true
+	}
+	cr.writer.Write(row)
+	cr.writer.Flush()
+	cr.err = cr.writer.Error()
+}
+
+// returns the first error encountered while writing reports
+func (cr *CSVReporter) Err() error {
+	cr.lock.Lock()
+	defer cr.lock.Unlock()
+	return cr.err
+}
+
+func (cr *CSVReporter) ReportTurn(record TurnRecord, numAgents int, data DiagnosticsData) {
+	cr.write([]string{"turn", strconv.Itoa(record.Iteration), strconv.Itoa(record.Turn), strconv.Itoa(numAgents),
+		strconv.Itoa(record.Sent), strconv.Itoa(record.Delivered), strconv.Itoa(record.Dropped), strconv.Itoa(record.EndMessagings)})
+}
+
+func (cr *CSVReporter) ReportIteration(iteration int, turns []TurnRecord) {
+	sent, delivered, dropped := sumTurns(turns)
+	cr.write([]string{"iteration", strconv.Itoa(iteration), "", "",
+		strconv.Itoa(sent), strconv.Itoa(delivered), strconv.Itoa(dropped), ""})
+}
+
+func (cr *CSVReporter) ReportRun(summary HistorySummary) {
+	cr.write([]string{"run", "", "", "",
+		strconv.Itoa(summary.TotalSent), strconv.Itoa(summary.TotalDelivered), strconv.Itoa(summary.TotalDropped), strconv.Itoa(summary.TotalEndMessagings)})
+}
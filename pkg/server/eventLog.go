@@ -0,0 +1,53 @@
+package server
+
+import (
+	"time"
+
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/events"
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/message"
+	"github.com/google/uuid"
+)
+
+// registers a sink to receive every event of the simulation. Several sinks may be registered
+func (serv *BaseServer[T]) AddEventSink(sink events.EventSink) {
+	serv.eventSinkLock.Lock()
+	defer serv.eventSinkLock.Unlock()
+	serv.eventSinks = append(serv.eventSinks, sink)
+	serv.eventSinkCount.Add(1)
+}
+
+// returns whether any event sinks are registered, so that events need not be built otherwise
+func (serv *BaseServer[T]) HasEventSinks() bool {
+	return serv.eventSinkCount.Load() > 0
+}
+
+// stamps an event with the current time, iteration and turn, then passes it to every sink
+func (serv *BaseServer[T]) EmitEvent(event events.Event) {
+	serv.eventSinkLock.RLock()
+	defer serv.eventSinkLock.RUnlock()
+	if len(serv.eventSinks) == 0 {
+		return
+	}
+	event.Time = time.Now()
+	event.Iteration = serv.GetCurrentIteration()
+	event.Turn = serv.GetCurrentTurn()
+	for _, sink := range serv.eventSinks {
+		sink.Emit(event)
+	}
+}
+
+func (serv *BaseServer[T]) emitMessageEvent(eventType events.EventType, msg message.IMessage[T], recipient uuid.UUID, detail string) {
+	if !serv.HasEventSinks() {
+		return
+	}
+	event := events.CreateMessageEvent(eventType, msg, recipient, detail)
+	event.MessageType = serv.GetMessageTypeName(msg)
+	serv.EmitEvent(event)
+}
+
+func (serv *BaseServer[T]) emitAgentEvent(eventType events.EventType, id uuid.UUID) {
+	if !serv.HasEventSinks() {
+		return
+	}
+	serv.EmitEvent(events.Event{Type: eventType, Agent: id})
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+// a named set of agents that can be messaged together
+type agentGroup struct {
+	name string
+	// member IDs in order of joining
+	members []uuid.UUID
+}
+
+// creates a group containing the given agents, returning its ID. Fails without creating the group if any agent does not exist
+func (serv *BaseServer[T]) CreateGroup(name string, ids ...uuid.UUID) (uuid.UUID, error) {
+	serv.groupLock.Lock()
+	defer serv.groupLock.Unlock()
+	group := &agentGroup{name: name, members: []uuid.UUID{}}
+	for _, id := range ids {
+		if _, known := serv.agentMap[id]; !known {
+			return uuid.Nil, fmt.Errorf("agent %s does not exist", id)
+		}
+		if !slices.Contains(group.members, id) {
+			group.members = append(group.members, id)
+		}
+	}
+	groupID := serv.generateGroupID()
+	serv.groups[groupID] = group
+	return groupID, nil
+}
+
+func (serv *BaseServer[T]) DeleteGroup(groupID uuid.UUID) {
+	serv.groupLock.Lock()
+	defer serv.groupLock.Unlock()
+	delete(serv.groups, groupID)
+}
+
+func (serv *BaseServer[T]) JoinGroup(groupID, agentID uuid.UUID) error {
+	serv.groupLock.Lock()
+	defer serv.groupLock.Unlock()
+	group, ok := serv.groups[groupID]
+	if !ok {
+		return fmt.Errorf("group %s does not exist", groupID)
+	}
+	if _, known := serv.agentMap[agentID]; !known {
+		return fmt.Errorf("agent %s does not exist", agentID)
+	}
+	if !slices.Contains(group.members, agentID) {
+		group.members = append(group.members, agentID)
+	}
+	return nil
+}
+
+func (serv *BaseServer[T]) LeaveGroup(groupID, agentID uuid.UUID) error {
+	serv.groupLock.Lock()
+	defer serv.groupLock.Unlock()
+	group, ok := serv.groups[groupID]
+	if !ok {
+		return fmt.Errorf("group %s does not exist", groupID)
+	}
+	group.members = slices.DeleteFunc(group.members, func(id uuid.UUID) bool {
+		return id == agentID
+	})
+	return nil
+}
+
+func (serv *BaseServer[T]) ViewGroupMembers(groupID uuid.UUID) []uuid.UUID {
+	serv.groupLock.RLock()
+	defer serv.groupLock.RUnlock()
+	group, ok := serv.groups[groupID]
+	if !ok {
+		return nil
+	}
+	return slices.Clone(group.members)
+}
+
+// returns map of groupid -> group name
+func (serv *BaseServer[T]) ViewGroups() map[uuid.UUID]string {
+	serv.groupLock.RLock()
+	defer serv.groupLock.RUnlock()
+	groups := make(map[uuid.UUID]string, len(serv.groups))
+	for groupID, group := range serv.groups {
+		groups[groupID] = group.name
+	}
+	return groups
+}
+
+// removes an agent from every group it belongs to
+func (serv *BaseServer[T]) leaveAllGroups(agentID uuid.UUID) {
+	serv.groupLock.Lock()
+	defer serv.groupLock.Unlock()
+	for _, group := range serv.groups {
+		group.members = slices.DeleteFunc(group.members, func(id uuid.UUID) bool {
+			return id == agentID
+		})
+	}
+}
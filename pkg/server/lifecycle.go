@@ -0,0 +1,149 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// returned by StartWithContext when a run is cancelled or stopped before completion
+type RunHaltedError struct {
+	// iteration during which the run halted
+	Iteration int
+	// turn during which the run halted (-1 if halted between iterations)
+	Turn int
+	// reason for the halt, as reported by the run's context
+	Cause error
+}
+
+func (e *RunHaltedError) Error() string {
+	return fmt.Sprintf("run halted at iteration %d, turn %d: %v", e.Iteration, e.Turn, e.Cause)
+}
+
+func (e *RunHaltedError) Unwrap() error {
+	return e.Cause
+}
+
+// cancels a run started with Start or StartWithContext. Has no effect if no run is in progress
+func (serv *BaseServer[T]) Stop() {
+	serv.runLock.Lock()
+	defer serv.runLock.Unlock()
+	if serv.runCancel != nil {
+		serv.runCancel()
+	}
+}
+
+// returns the context of the run in progress, or a background context between runs
+func (serv *BaseServer[T]) runContext() context.Context {
+	serv.runLock.Lock()
+	defer serv.runLock.Unlock()
+	return serv.runCtx
+}
+
+func (serv *BaseServer[T]) beginRun(parent context.Context) context.Context {
+	serv.runLock.Lock()
+	defer serv.runLock.Unlock()
+	serv.runCtx, serv.runCancel = context.WithCancel(parent)
+	return serv.runCtx
+}
+
+// cancels the run context, then gives in-flight deliveries up to one turn timeout to finish
+func (serv *BaseServer[T]) endRun() {
+	serv.runLock.Lock()
+	serv.runCancel()
+	serv.runCtx, serv.runCancel = context.Background(), nil
+	serv.runLock.Unlock()
+	serv.setCurrentTurnStamp(-1, -1)
+	deliveriesDone := make(chan struct{})
+	go func() {
+		serv.inFlightDeliveries.Wait()
+		close(deliveriesDone)
+	}()
+	select {
+	case <-deliveriesDone:
+	case <-time.After(serv.turnTimeout):
+	}
+}
+
+// outcome of a single turn
+type TurnStatus struct {
+	Iteration int `json:"iteration"`
+	Turn      int `json:"turn"`
+	// whether the turn ran to completion (false if halted or failed)
+	Completed bool `json:"completed"`
+	// whether every agent signalled messaging complete before the session timed out
+	MessagingComplete bool `json:"messagingComplete"`
+	// number of agents which signalled messaging complete (in the last session, for multi-phase turns)
+	AgentsFinishedMessaging int `json:"agentsFinishedMessaging"`
+}
+
+// outcome of a run, returned by Start and StartWithContext
+type RunResult struct {
+	// iterations run to completion by this run (excluding any completed before a restore)
+	CompletedIterations int `json:"completedIterations"`
+	// status of every turn started by this run, in order
+	Turns []TurnStatus `json:"turns"`
+	// reason the run ended early through a stop condition ("" if not stopped early)
+	StopReason string `json:"stopReason,omitempty"`
+	// reasons iterations ended early through iteration-only stop conditions, by iteration
+	IterationStopReasons map[int]string `json:"iterationStopReasons,omitempty"`
+	// reason the run failed or halted (nil if it completed)
+	Err error `json:"-"`
+}
+
+// returns the number of turns run to completion
+func (rr RunResult) CompletedTurns() int {
+	completed := 0
+	for _, status := range rr.Turns {
+		if status.Completed {
+			completed++
+		}
+	}
+	return completed
+}
+
+// encodes the result as JSON, with the error as a message
+func (rr RunResult) MarshalJSON() ([]byte, error) {
+	type plainResult RunResult
+	encoded := struct {
+		plainResult
+		CompletedTurns int    `json:"completedTurns"`
+		Error          string `json:"error,omitempty"`
+	}{plainResult: plainResult(rr), CompletedTurns: rr.CompletedTurns()}
+	if rr.Err != nil {
+		encoded.Error = rr.Err.Error()
+	}
+	return json.Marshal(encoded)
+}
+
+// adapts a GameRunner (including a ContextGameRunner) to a FallibleGameRunner which never fails
+func AdaptGameRunner(runner GameRunner) FallibleGameRunner {
+	if runner == nil {
+		return nil
+	}
+	return &gameRunnerAdapter{runner: runner}
+}
+
+type gameRunnerAdapter struct {
+	runner GameRunner
+}
+
+func (ga *gameRunnerAdapter) RunStartOfIteration(iteration int) error {
+	ga.runner.RunStartOfIteration(iteration)
+	return nil
+}
+
+func (ga *gameRunnerAdapter) RunTurn(ctx context.Context, iteration, turn int) error {
+	if runner, ok := ga.runner.(ContextGameRunner); ok {
+		runner.RunTurnWithContext(ctx, iteration, turn)
+		return nil
+	}
+	ga.runner.RunTurn(iteration, turn)
+	return nil
+}
+
+func (ga *gameRunnerAdapter) RunEndOfIteration(iteration int) error {
+	ga.runner.RunEndOfIteration(iteration)
+	return nil
+}
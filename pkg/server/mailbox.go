@@ -0,0 +1,55 @@
+package server
+
+import (
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/events"
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/message"
+	"github.com/google/uuid"
+)
+
+// switches delivery to mailbox mode, in which messages are placed in a bounded inbox per agent
+// instead of invoking handlers on the sender's goroutine. Agents then handle their messages on their
+// own schedule with ProcessInbox or Receive. Messages arriving at a full inbox are dropped
+func (server *BaseServer[T]) EnableMailboxDelivery(capacity int) {
+	if capacity <= 0 {
+		panic("Mailbox capacity must be positive")
+	}
+	server.mailboxLock.Lock()
+	defer server.mailboxLock.Unlock()
+	server.mailboxCapacity = capacity
+	server.mailboxes = make(map[uuid.UUID]chan message.IMessage[T])
+}
+
+func (server *BaseServer[T]) Inbox(id uuid.UUID) <-chan message.IMessage[T] {
+	return server.mailbox(id)
+}
+
+// returns the agent's inbox, creating it on first use (nil when not in mailbox mode)
+func (server *BaseServer[T]) mailbox(id uuid.UUID) chan message.IMessage[T] {
+	server.mailboxLock.Lock()
+	defer server.mailboxLock.Unlock()
+	if server.mailboxCapacity == 0 {
+		return nil
+	}
+	inbox, ok := server.mailboxes[id]
+	if !ok {
+		inbox = make(chan message.IMessage[T], server.mailboxCapacity)
+		server.mailboxes[id] = inbox
+	}
+	return inbox
+}
+
+func (server *BaseServer[T]) deleteMailbox(id uuid.UUID) {
+	server.mailboxLock.Lock()
+	defer server.mailboxLock.Unlock()
+	delete(server.mailboxes, id)
+}
+
+func (server *BaseServer[T]) postToMailbox(inbox chan message.IMessage[T], msg message.IMessage[T], recipient uuid.UUID) {
+	select {
+	case inbox <- msg:
+		server.emitMessageEvent(events.MessageDelivered, msg, recipient, "")
+	default:
+		server.diagnosticsEngine.ReportInboxOverflow()
+		server.emitMessageEvent(events.MessageDropped, msg, recipient, events.DropInboxFull)
+	}
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"time"
+)
+
+// names of the game runner calls, as passed to middleware
+const (
+	CallStartOfIteration = "RunStartOfIteration"
+	CallTurn             = "RunTurn"
+	CallEndOfIteration   = "RunEndOfIteration"
+)
+
+// wraps a game runner with additional behaviour. Plain GameRunners are adapted before wrapping
+type RunnerMiddleware func(next FallibleGameRunner) FallibleGameRunner
+
+// wraps every call to the game runner with the given middleware. The first registered is outermost
+func (serv *BaseServer[T]) UseRunnerMiddleware(middleware ...RunnerMiddleware) {
+	serv.runnerMiddleware = append(serv.runnerMiddleware, middleware...)
+}
+
+// returns the game runner, running turns as phases if any are set, wrapped in the registered middleware
+func (serv *BaseServer[T]) wrappedGameRunner() FallibleGameRunner {
+	runner := serv.gameRunner
+	if len(serv.turnPhases) > 0 {
+		runner = &phasedGameRunner[T]{FallibleGameRunner: runner, serv: serv}
+	}
+	for i := len(serv.runnerMiddleware) - 1; i >= 0; i-- {
+		runner = serv.runnerMiddleware[i](runner)
+	}
+	return runner
+}
+
+// passes every call of a runner through a single function, given the call's name, iteration and
+// turn (-1 outside RunTurn) and a function invoking the wrapped call
+type aroundRunner struct {
+	next   FallibleGameRunner
+	around func(call string, iteration, turn int, invoke func() error) error
+}
+
+func wrapCalls(next FallibleGameRunner, around func(string, int, int, func() error) error) FallibleGameRunner {
+	return &aroundRunner{next: next, around: around}
+}
+
+func (ar *aroundRunner) RunStartOfIteration(iteration int) error {
+	return ar.around(CallStartOfIteration, iteration, -1, func() error {
+		return ar.next.RunStartOfIteration(iteration)
+	})
+}
+
+func (ar *aroundRunner) RunTurn(ctx context.Context, iteration, turn int) error {
+	return ar.around(CallTurn, iteration, turn, func() error {
+		return ar.next.RunTurn(ctx, iteration, turn)
+	})
+}
+
+func (ar *aroundRunner) RunEndOfIteration(iteration int) error {
+	return ar.around(CallEndOfIteration, iteration, -1, func() error {
+		return ar.next.RunEndOfIteration(iteration)
+	})
+}
+
+// reports the duration of every game runner call
+func TimingMiddleware(record func(call string, iteration, turn int, elapsed time.Duration)) RunnerMiddleware {
+	return func(next FallibleGameRunner) FallibleGameRunner {
+		return wrapCalls(next, func(call string, iteration, turn int, invoke func() error) error {
+			start := time.Now()
+			err := invoke()
+			record(call, iteration, turn, time.Since(start))
+			return err
+		})
+	}
+}
+
+// returned in place of a panic in a game runner call
+type RunnerPanicError struct {
+	Call      string
+	Iteration int
+	Turn      int
+	// value passed to panic
+	Value any
+	// stack trace at the point of recovery
+	Stack []byte
+}
+
+func (e *RunnerPanicError) Error() string {
+	return fmt.Sprintf("%s panicked at iteration %d, turn %d: %v", e.Call, e.Iteration, e.Turn, e.Value)
+}
+
+// converts panics in game runner calls into a RunnerPanicError, halting the run with an error
+func RecoveryMiddleware() RunnerMiddleware {
+	return func(next FallibleGameRunner) FallibleGameRunner {
+		return wrapCalls(next, func(call string, iteration, turn int, invoke func() error) (err error) {
+			defer func() {
+				if value := recover(); value != nil {
+					err = &RunnerPanicError{Call: call, Iteration: iteration, Turn: turn, Value: value, Stack: debug.Stack()}
+				}
+			}()
+			return invoke()
+		})
+	}
+}
+
+// logs every game runner call with its duration at debug level, or at error level if it fails
+func LoggingMiddleware(logger *slog.Logger) RunnerMiddleware {
+	return func(next FallibleGameRunner) FallibleGameRunner {
+		return wrapCalls(next, func(call string, iteration, turn int, invoke func() error) error {
+			start := time.Now()
+			err := invoke()
+			attrs := []any{
+				slog.String("call", call),
+				slog.Int("iteration", iteration),
+				slog.Int("turn", turn),
+				slog.Duration("elapsed", time.Since(start)),
+			}
+			if err != nil {
+				logger.Error("game runner call failed", append(attrs, slog.String("error", err.Error()))...)
+			} else {
+				logger.Debug("game runner call completed", attrs...)
+			}
+			return err
+		})
+	}
+}
+
+// checks an invariant after every successful game runner call, failing the call if it is violated
+func InvariantMiddleware(name string, check func() error) RunnerMiddleware {
+	return func(next FallibleGameRunner) FallibleGameRunner {
+		return wrapCalls(next, func(call string, iteration, turn int, invoke func() error) error {
+			if err := invoke(); err != nil {
+				return err
+			}
+			if err := check(); err != nil {
+				return fmt.Errorf("invariant %q violated after %s at iteration %d, turn %d: %w", name, call, iteration, turn, err)
+			}
+			return nil
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/agent"
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/message"
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/transport"
+	"github.com/google/uuid"
+)
+
+// lets agents running in another process take part in the server's runs. The other process runs
+// its agents on a server of its own, which calls JoinSharedServer over the same connection.
+// Remote agents can message and be messaged by every agent in the run, are reached by broadcasts
+// (unless a topology says otherwise) and are counted in every messaging session. Each iteration
+// and turn is forwarded to their process, where their lifecycle hooks are invoked; as they are
+// not in the agent map, game runners and schedulers only drive local agents. Agents on either
+// server must be added before connecting. Blocks until the stream is closed, returning the
+// error which ended it (nil if closed cleanly), after which the remote agents are dropped
+func (serv *BaseServer[T]) ServeRemoteAgents(stream *transport.StreamTransport[T]) error {
+	serv.remoteLock.Lock()
+	serv.remoteLinks = append(serv.remoteLinks, stream)
+	announced := append(slices.Clone(serv.agentOrder), serv.remoteOrder...)
+	serv.remoteLock.Unlock()
+	defer serv.disconnect(stream)
+	// announced concurrently, as the peer may be announcing its own agents rather than reading
+	go stream.AnnounceAgents(announced...)
+	return stream.Serve(&streamLink[T]{serv: serv, stream: stream})
+}
+
+// runs the server's agents in a shared server's runs, connecting over a stream to a process which
+// called ServeRemoteAgents. This server does not start runs of its own: its agents follow the
+// shared server's iterations and turns through their lifecycle hooks, can message every agent of
+// the shared run, and their messaging complete signals are counted by the shared server.
+// Deterministic mode is not supported, as queued messages are only sent at the end of a run's
+// messaging sessions. Blocks until the stream is closed, returning the error which ended it
+func (serv *BaseServer[T]) JoinSharedServer(stream *transport.StreamTransport[T]) error {
+	if serv.deterministic {
+		return errors.New("deterministic mode is not supported when joining a shared server")
+	}
+	serv.remoteLock.Lock()
+	serv.sharedServer = stream
+	announced := slices.Clone(serv.agentOrder)
+	serv.remoteLock.Unlock()
+	defer serv.disconnect(stream)
+	// announced concurrently, as the peer may be announcing its own agents rather than reading
+	go stream.AnnounceAgents(announced...)
+	return stream.Serve(&streamLink[T]{serv: serv, stream: stream})
+}
+
+// the end of a stream connecting the server to a peer process
+type streamLink[T agent.IAgent[T]] struct {
+	serv   *BaseServer[T]
+	stream *transport.StreamTransport[T]
+}
+
+func (sl *streamLink[T]) AcceptsRecipient(id uuid.UUID) bool {
+	if _, ok := sl.serv.agentMap[id]; ok {
+		return true
+	}
+	return sl.serv.remoteStream(id) != nil
+}
+
+func (sl *streamLink[T]) DeliverMessage(msg message.IMessage[T], recipient uuid.UUID) {
+	sl.serv.DeliverMessage(msg, recipient)
+}
+
+func (sl *streamLink[T]) AddRemoteAgents(ids []uuid.UUID) {
+	sl.serv.addRemoteAgents(sl.stream, ids)
+}
+
+func (sl *streamLink[T]) RemoteAgentStoppedTalking(id uuid.UUID) {
+	go sl.serv.AgentStoppedTalking(id)
+}
+
+func (sl *streamLink[T]) FollowLifecycle(stage string, iteration, turn int) {
+	if sl.serv.sharedServerStream() == sl.stream {
+		sl.serv.followLifecycle(stage, iteration, turn)
+	}
+}
+
+// records agents living behind a stream, and announces them to the server's other remote processes
+func (serv *BaseServer[T]) addRemoteAgents(stream *transport.StreamTransport[T], ids []uuid.UUID) {
+	serv.remoteLock.Lock()
+	for _, id := range ids {
+		if _, exists := serv.remoteAgents[id]; !exists {
+			serv.remoteOrder = append(serv.remoteOrder, id)
+		}
+		serv.remoteAgents[id] = stream
+	}
+	serv.remoteAgentCount.Store(int32(len(serv.remoteAgents)))
+	others := []*transport.StreamTransport[T]{}
+	for _, link := range serv.remoteLinks {
+		if link != stream {
+			others = append(others, link)
+		}
+	}
+	serv.remoteLock.Unlock()
+	for _, link := range others {
+		link.AnnounceAgents(ids...)
+	}
+}
+
+// drops a stream and every agent living behind it
+func (serv *BaseServer[T]) disconnect(stream *transport.StreamTransport[T]) {
+	serv.remoteLock.Lock()
+	defer serv.remoteLock.Unlock()
+	if serv.sharedServer == stream {
+		serv.sharedServer = nil
+	}
+	serv.remoteLinks = slices.DeleteFunc(serv.remoteLinks, func(link *transport.StreamTransport[T]) bool {
+		return link == stream
+	})
+	serv.remoteOrder = slices.DeleteFunc(serv.remoteOrder, func(id uuid.UUID) bool {
+		return serv.remoteAgents[id] == stream
+	})
+	for id, link := range serv.remoteAgents {
+		if link == stream {
+			delete(serv.remoteAgents, id)
+		}
+	}
+	serv.remoteAgentCount.Store(int32(len(serv.remoteAgents)))
+}
+
+// returns the stream reaching a remote agent (nil if the agent is not remote)
+func (serv *BaseServer[T]) remoteStream(id uuid.UUID) *transport.StreamTransport[T] {
+	if serv.remoteAgentCount.Load() == 0 {
+		return nil
+	}
+	serv.remoteLock.RLock()
+	defer serv.remoteLock.RUnlock()
+	return serv.remoteAgents[id]
+}
+
+func (serv *BaseServer[T]) viewRemoteAgentIds() []uuid.UUID {
+	serv.remoteLock.RLock()
+	defer serv.remoteLock.RUnlock()
+	return slices.Clone(serv.remoteOrder)
+}
+
+func (serv *BaseServer[T]) sharedServerStream() *transport.StreamTransport[T] {
+	serv.remoteLock.RLock()
+	defer serv.remoteLock.RUnlock()
+	return serv.sharedServer
+}
+
+// passes a stage of the run to the processes of remote agents
+func (serv *BaseServer[T]) forwardLifecycle(stage string, iteration, turn int) {
+	serv.remoteLock.RLock()
+	links := slices.Clone(serv.remoteLinks)
+	serv.remoteLock.RUnlock()
+	for _, link := range links {
+		link.ForwardLifecycle(stage, iteration, turn)
+	}
+}
+
+// runs a stage of the shared server's run on this server's agents
+func (serv *BaseServer[T]) followLifecycle(stage string, iteration, turn int) {
+	switch stage {
+	case transport.StageIterationStart:
+		serv.setCurrentTurnStamp(iteration, -1)
+		serv.notifyIterationStart(iteration)
+	case transport.StageTurnStart:
+		serv.setCurrentTurnStamp(iteration, turn)
+		serv.turnStartTime.Store(time.Now().UnixNano())
+		serv.notifyTurnStart(iteration, turn)
+	case transport.StageTurnEnd:
+		serv.notifyTurnEnd(iteration, turn)
+		serv.setCurrentTurnStamp(iteration, -1)
+	case transport.StageIterationEnd:
+		serv.notifyIterationEnd(iteration)
+		serv.setCurrentTurnStamp(-1, -1)
+	}
+}
@@ -0,0 +1,294 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/message"
+	"github.com/google/uuid"
+)
+
+// a single delivery, as written to a delivery log
+type DeliveryRecord struct {
+	// position of the delivery in the log, starting at 0
+	Sequence  int       `json:"sequence"`
+	Iteration int       `json:"iteration"`
+	Turn      int       `json:"turn"`
+	Sender    uuid.UUID `json:"sender"`
+	Recipient uuid.UUID `json:"recipient"`
+	// message envelope, as encoded by the codec registry
+	Message json.RawMessage `json:"message"`
+	// whether the sender produced the message while handling an earlier delivery, so a replay
+	// expects the agents to send it again
+	Produced bool `json:"produced,omitempty"`
+	// whether the message was dropped (lost by the channel model, expired or discarded at the
+	// end of a messaging session) rather than delivered
+	Dropped bool `json:"dropped,omitempty"`
+}
+
+// returned by Replay when agents produce a message absent from the recording, or fail to
+// produce a message which the recording attributes to their handlers
+type ReplayDivergenceError struct {
+	// sequence number of the recorded delivery being replayed when an unrecorded message was
+	// produced, or of the recorded message which was not produced
+	Sequence  int
+	Sender    uuid.UUID
+	Recipient uuid.UUID
+	// encoded message which the recording did not contain ("" if a recorded message was not produced)
+	Produced string
+	// encoded message which the agents did not produce ("" if an unrecorded message was produced)
+	Missing string
+}
+
+func (e *ReplayDivergenceError) Error() string {
+	if e.Missing != "" {
+		return fmt.Sprintf("replay diverged at delivery %d: %s never sent recorded message %s to %s", e.Sequence, e.Sender, e.Missing, e.Recipient)
+	}
+	return fmt.Sprintf("replay diverged while replaying delivery %d: %s sent unrecorded message %s to %s", e.Sequence, e.Sender, e.Produced, e.Recipient)
+}
+
+type deliveryRecorder[T any] struct {
+	lock     sync.Mutex
+	encoder  *json.Encoder
+	codec    *message.CodecRegistry[T]
+	sequence int
+	// first error encountered while recording, after which deliveries are no longer written
+	err error
+}
+
+// writes every subsequent delivery to w as a line of JSON, encoding messages with the codec.
+// Every message type delivered must be registered with the codec
+func (serv *BaseServer[T]) RecordDeliveries(w io.Writer, codec *message.CodecRegistry[T]) {
+	serv.replayLock.Lock()
+	defer serv.replayLock.Unlock()
+	serv.recorder = &deliveryRecorder[T]{
+		encoder: json.NewEncoder(w),
+		codec:   codec,
+	}
+	serv.recording.Store(true)
+}
+
+// stops recording deliveries, returning the first error encountered while recording
+func (serv *BaseServer[T]) StopRecording() error {
+	serv.replayLock.Lock()
+	defer serv.replayLock.Unlock()
+	if serv.recorder == nil {
+		return nil
+	}
+	err := serv.recorder.err
+	serv.recorder = nil
+	serv.recording.Store(false)
+	return err
+}
+
+func (serv *BaseServer[T]) recordDelivery(msg message.IMessage[T], recipient uuid.UUID, produced bool) {
+	serv.writeRecord(msg, recipient, produced, false)
+}
+
+func (serv *BaseServer[T]) recordDrop(msg message.IMessage[T], recipient uuid.UUID, produced bool) {
+	serv.writeRecord(msg, recipient, produced, true)
+}
+
+func (serv *BaseServer[T]) writeRecord(msg message.IMessage[T], recipient uuid.UUID, produced, dropped bool) {
+	serv.replayLock.RLock()
+	recorder := serv.recorder
+	serv.replayLock.RUnlock()
+	if recorder == nil {
+		return
+	}
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	if recorder.err != nil {
+		return
+	}
+	encoded, err := recorder.codec.EncodeJSON(msg)
+	if err != nil {
+		recorder.err = err
+		return
+	}
+	recorder.err = recorder.encoder.Encode(DeliveryRecord{
+		Sequence:  recorder.sequence,
+		Iteration: serv.GetCurrentIteration(),
+		Turn:      serv.GetCurrentTurn(),
+		Sender:    msg.GetSender(),
+		Recipient: recipient,
+		Message:   encoded,
+		Produced:  produced,
+		Dropped:   dropped,
+	})
+	recorder.sequence++
+}
+
+type replaySession[T any] struct {
+	lock    sync.Mutex
+	codec   *message.CodecRegistry[T]
+	records []DeliveryRecord
+	// comparable form of each recorded message
+	normalised []string
+	// recorded deliveries already matched to a produced message
+	claimed []bool
+	// index of the recorded delivery being replayed
+	current int
+	// first divergence found (nil if none)
+	divergence *ReplayDivergenceError
+}
+
+// returns the replay in progress (nil if not replaying)
+func (serv *BaseServer[T]) replaySession() *replaySession[T] {
+	serv.replayLock.RLock()
+	defer serv.replayLock.RUnlock()
+	return serv.replay
+}
+
+func (serv *BaseServer[T]) beginHandling(id uuid.UUID) {
+	serv.handlingLock.Lock()
+	defer serv.handlingLock.Unlock()
+	serv.handling[id]++
+}
+
+func (serv *BaseServer[T]) endHandling(id uuid.UUID) {
+	serv.handlingLock.Lock()
+	defer serv.handlingLock.Unlock()
+	serv.handling[id]--
+	if serv.handling[id] == 0 {
+		delete(serv.handling, id)
+	}
+}
+
+// reports whether an agent is handling a message, in which case messages it sends are produced by the handler
+func (serv *BaseServer[T]) isHandling(id uuid.UUID) bool {
+	serv.handlingLock.Lock()
+	defer serv.handlingLock.Unlock()
+	return serv.handling[id] > 0
+}
+
+// reads a delivery log written by RecordDeliveries and delivers each recorded message, in order,
+// to the server's agents, which must have the same IDs as in the recorded run (for example by
+// using the same seed in deterministic mode). Messages the agents send while handling replayed
+// deliveries are not delivered, but must match a later message in the log; recorded messages
+// which handlers produced must in turn be sent again before their delivery is replayed. The first
+// mismatch either way is returned as a ReplayDivergenceError. Recorded drops are matched but not
+// delivered. Messages are compared ignoring their IDs and timestamps
+func (serv *BaseServer[T]) Replay(r io.Reader, codec *message.CodecRegistry[T]) error {
+	session := &replaySession[T]{codec: codec}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var record DeliveryRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return fmt.Errorf("unable to decode delivery %d: %w", len(session.records), err)
+		}
+		normalised, err := normaliseEnvelope(record.Message)
+		if err != nil {
+			return fmt.Errorf("unable to decode message of delivery %d: %w", record.Sequence, err)
+		}
+		session.records = append(session.records, record)
+		session.normalised = append(session.normalised, normalised)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	session.claimed = make([]bool, len(session.records))
+
+	serv.replayLock.Lock()
+	serv.replay = session
+	serv.replayLock.Unlock()
+	defer func() {
+		serv.replayLock.Lock()
+		serv.replay = nil
+		serv.replayLock.Unlock()
+	}()
+
+	for i, record := range session.records {
+		session.lock.Lock()
+		session.current = i
+		claimed := session.claimed[i]
+		session.lock.Unlock()
+		if record.Produced && !claimed {
+			return &ReplayDivergenceError{
+				Sequence:  record.Sequence,
+				Sender:    record.Sender,
+				Recipient: record.Recipient,
+				Missing:   session.normalised[i],
+			}
+		}
+		if record.Dropped {
+			continue
+		}
+		msg, err := codec.DecodeJSON(record.Message)
+		if err != nil {
+			return fmt.Errorf("unable to decode message of delivery %d: %w", record.Sequence, err)
+		}
+		if _, ok := serv.agentMap[record.Recipient]; !ok {
+			return fmt.Errorf("recipient %s of delivery %d is not on the server", record.Recipient, record.Sequence)
+		}
+		serv.setCurrentTurnStamp(record.Iteration, record.Turn)
+		serv.deliver(msg, record.Recipient)
+		if divergence := session.firstDivergence(); divergence != nil {
+			return divergence
+		}
+	}
+	serv.setCurrentTurnStamp(-1, -1)
+	return nil
+}
+
+// matches a message produced during replay against the unclaimed recorded deliveries after the current one
+func (rs *replaySession[T]) checkProduced(msg message.IMessage[T], recipient uuid.UUID) {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	if rs.divergence != nil {
+		return
+	}
+	encoded, err := rs.codec.EncodeJSON(msg)
+	produced := string(encoded)
+	if err == nil {
+		produced, err = normaliseEnvelope(encoded)
+	}
+	if err == nil {
+		for i := rs.current + 1; i < len(rs.records); i++ {
+			record := rs.records[i]
+			if rs.claimed[i] || record.Sender != msg.GetSender() || record.Recipient != recipient {
+				continue
+			}
+			if rs.normalised[i] == produced {
+				rs.claimed[i] = true
+				return
+			}
+		}
+	}
+	rs.divergence = &ReplayDivergenceError{
+		Sequence:  rs.records[rs.current].Sequence,
+		Sender:    msg.GetSender(),
+		Recipient: recipient,
+		Produced:  produced,
+	}
+}
+
+func (rs *replaySession[T]) firstDivergence() *ReplayDivergenceError {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	return rs.divergence
+}
+
+// fields of BaseMessage which legitimately differ between a run and its replay
+var unreplayableFields = []string{"ID", "SentAt", "InReplyTo"}
+
+// returns a comparable form of an encoded message envelope, without unreplayable fields
+func normaliseEnvelope(encoded []byte) (string, error) {
+	var envelope message.Envelope
+	if err := json.Unmarshal(encoded, &envelope); err != nil {
+		return "", err
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(envelope.Payload, &payload); err != nil {
+		return "", err
+	}
+	for _, field := range unreplayableFields {
+		delete(payload, field)
+	}
+	normalised, err := json.Marshal(map[string]any{"type": envelope.Type, "payload": payload})
+	return string(normalised), err
+}
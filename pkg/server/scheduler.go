@@ -0,0 +1,169 @@
+package server
+
+import (
+	"math/rand"
+	"slices"
+	"sync"
+
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/agent"
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/events"
+	"github.com/google/uuid"
+)
+
+// stage passed to the activation function to call an agent's Step
+const StageStep = ""
+
+// stage passed to the activation function to call an agent's Advance
+const StageAdvance = "advance"
+
+// decides the order (and concurrency) in which agents are activated each turn
+type Scheduler[T any] interface {
+	// activates the agents, given in order of addition to the server, by calling activate
+	// with each agent and the stage to run (StageStep, StageAdvance or a named stage)
+	Schedule(agents []T, activate func(agent T, stage string))
+}
+
+// activates agents one at a time, in order of addition
+type SequentialScheduler[T any] struct{}
+
+func CreateSequentialScheduler[T any]() *SequentialScheduler[T] {
+	return &SequentialScheduler[T]{}
+}
+
+func (ss *SequentialScheduler[T]) Schedule(agents []T, activate func(T, string)) {
+	for _, ag := range agents {
+		activate(ag, StageStep)
+	}
+}
+
+// activates agents one at a time, in an order shuffled every turn by a seeded source
+type RandomScheduler[T any] struct {
+	rng *rand.Rand
+}
+
+func CreateRandomScheduler[T any](seed int64) *RandomScheduler[T] {
+	return &RandomScheduler[T]{rng: rand.New(rand.NewSource(seed))}
+}
+
+func (rs *RandomScheduler[T]) Schedule(agents []T, activate func(T, string)) {
+	shuffled := slices.Clone(agents)
+	rs.rng.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	for _, ag := range shuffled {
+		activate(ag, StageStep)
+	}
+}
+
+// runs each named stage for every agent, in order of addition, before moving on to the next stage
+type StagedScheduler[T any] struct {
+	stages []string
+}
+
+func CreateStagedScheduler[T any](stages ...string) *StagedScheduler[T] {
+	return &StagedScheduler[T]{stages: stages}
+}
+
+func (ss *StagedScheduler[T]) Schedule(agents []T, activate func(T, string)) {
+	for _, stage := range ss.stages {
+		for _, ag := range agents {
+			activate(ag, stage)
+		}
+	}
+}
+
+// steps every agent, then advances every agent, so that all agents decide based on the same state
+type SimultaneousScheduler[T any] struct{}
+
+func CreateSimultaneousScheduler[T any]() *SimultaneousScheduler[T] {
+	return &SimultaneousScheduler[T]{}
+}
+
+func (ss *SimultaneousScheduler[T]) Schedule(agents []T, activate func(T, string)) {
+	for _, ag := range agents {
+		activate(ag, StageStep)
+	}
+	for _, ag := range agents {
+		activate(ag, StageAdvance)
+	}
+}
+
+// steps agents concurrently on a bounded pool of workers
+type ConcurrentScheduler[T any] struct {
+	workers int
+}
+
+func CreateConcurrentScheduler[T any](workers int) *ConcurrentScheduler[T] {
+	if workers <= 0 {
+		panic("Concurrent scheduler requires at least one worker")
+	}
+	return &ConcurrentScheduler[T]{workers: workers}
+}
+
+func (cs *ConcurrentScheduler[T]) Schedule(agents []T, activate func(T, string)) {
+	queue := make(chan T)
+	var wg sync.WaitGroup
+	for w := 0; w < min(cs.workers, len(agents)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ag := range queue {
+				activate(ag, StageStep)
+			}
+		}()
+	}
+	for _, ag := range agents {
+		queue <- ag
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// sets the scheduler activating agents at the start of each turn (nil disables activation)
+func (serv *BaseServer[T]) SetScheduler(scheduler Scheduler[T]) {
+	serv.scheduler = scheduler
+}
+
+// returns the agents activated during the last scheduled turn, in order of activation
+func (serv *BaseServer[T]) GetActivationOrder() []uuid.UUID {
+	serv.activationLock.Lock()
+	defer serv.activationLock.Unlock()
+	return slices.Clone(serv.activationOrder)
+}
+
+func (serv *BaseServer[T]) scheduleAgents(iteration, turn int) {
+	if serv.scheduler == nil {
+		return
+	}
+	serv.activationLock.Lock()
+	serv.activationOrder = []uuid.UUID{}
+	serv.activationLock.Unlock()
+	agents := make([]T, 0, len(serv.agentOrder))
+	for _, id := range serv.agentOrder {
+		agents = append(agents, serv.agentMap[id])
+	}
+	serv.scheduler.Schedule(agents, func(ag T, stage string) {
+		serv.activateAgent(ag, stage, iteration, turn)
+	})
+}
+
+func (serv *BaseServer[T]) activateAgent(ag T, stage string, iteration, turn int) {
+	serv.activationLock.Lock()
+	serv.activationOrder = append(serv.activationOrder, ag.GetID())
+	serv.activationLock.Unlock()
+	serv.EmitEvent(events.Event{Type: events.AgentActivated, Agent: ag.GetID(), Detail: stage})
+	switch stage {
+	case StageStep:
+		if stepper, ok := any(ag).(agent.Stepper); ok {
+			stepper.Step(iteration, turn)
+		}
+	case StageAdvance:
+		if advancer, ok := any(ag).(agent.Advancer); ok {
+			advancer.Advance(iteration, turn)
+		}
+	default:
+		if stepper, ok := any(ag).(agent.StagedStepper); ok {
+			stepper.StepStage(stage, iteration, turn)
+		}
+	}
+}
@@ -1,7 +1,15 @@
 package server
 
 import (
+	"context"
+	"io"
+
 	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/agent"
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/events"
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/message"
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/network"
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/topology"
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/transport"
 	"github.com/google/uuid"
 )
 
@@ -12,6 +20,14 @@ type IAgentOperations[T agent.IAgent[T]] interface {
 	AddAgent(T)
 	// removes an agent from the server
 	RemoveAgent(T)
+	// gives the number of agents on the server, safe to call while a run is in progress
+	GetAgentCount() int
+	// creates a named group of agents for multicast messaging, returning its ID
+	CreateGroup(string, ...uuid.UUID) (uuid.UUID, error)
+	// deletes a group of agents
+	DeleteGroup(uuid.UUID)
+	// gives access to the names of all groups, by ID
+	ViewGroups() map[uuid.UUID]string
 }
 
 type IGameStateController interface {
@@ -21,8 +37,14 @@ type IGameStateController interface {
 	GetTurns() int
 	// injects a GameRunner interface into the server
 	SetGameRunner(GameRunner)
-	// begins simulator
-	Start()
+	// injects an error-aware game runner into the server, in place of a GameRunner
+	SetFallibleGameRunner(FallibleGameRunner)
+	// begins simulator, returning the outcome of the run
+	Start() RunResult
+	// begins simulator, halting with a RunHaltedError if the context is cancelled
+	StartWithContext(context.Context) (RunResult, error)
+	// halts a running simulator at the next opportunity
+	Stop()
 }
 
 type GameRunner interface {
@@ -31,6 +53,19 @@ type GameRunner interface {
 	RunEndOfIteration(int)
 }
 
+// optional extension of GameRunner, used in place of RunTurn to observe run cancellation
+type ContextGameRunner interface {
+	GameRunner
+	RunTurnWithContext(context.Context, int, int)
+}
+
+// error-aware alternative to GameRunner. An error halts the run and is recorded in its RunResult
+type FallibleGameRunner interface {
+	RunStartOfIteration(int) error
+	RunTurn(context.Context, int, int) error
+	RunEndOfIteration(int) error
+}
+
 type IServer[T agent.IAgent[T]] interface {
 	// gives operations for adding/removing agents from the simulator
 	IAgentOperations[T]
@@ -40,4 +75,56 @@ type IServer[T agent.IAgent[T]] interface {
 	IGameStateController
 	// toggle logging of messaging diagnostics to console (default false)
 	ReportMessagingDiagnostics()
+	// registers a destination for diagnostics at the end of each turn, iteration and run
+	AddDiagnosticsReporter(DiagnosticsReporter)
+	// invoke agent lifecycle hooks concurrently (default false, sequentially in order of addition)
+	SetParallelAgentHooks(bool)
+	// splits each turn into named phases, each with its own messaging session (default none, a single RunTurn)
+	SetTurnPhases(...TurnPhase[T])
+	// injects a scheduler activating agents at the start of each turn (default nil, no activation)
+	SetScheduler(Scheduler[T])
+	// gives the order in which agents were activated during the last scheduled turn
+	GetActivationOrder() []uuid.UUID
+	// registers a condition ending the run or iteration early, checked after every turn and iteration
+	AddStopCondition(StopCondition[T])
+	// gives the reason the last run ended early ("" if it ran every iteration)
+	GetStopReason() string
+	// wraps every call to the game runner with middleware, the first registered outermost
+	UseRunnerMiddleware(...RunnerMiddleware)
+	// seed agent IDs and serialise message deliveries so runs are reproducible (default false)
+	EnableDeterministicMode(int64)
+	// writes the state of the simulator to a checkpoint
+	Snapshot(io.Writer) error
+	// replaces the state of the simulator with a checkpoint, recreating agents with the factory
+	Restore(io.Reader, func() T) error
+	// injects a destination for checkpoints written at the end of each iteration
+	SetCheckpointWriter(func(int) (io.WriteCloser, error))
+	// injects the transport used to deliver messages (default in-process)
+	SetTransport(transport.Transport[T])
+	// lets agents in another process take part in runs over a stream, until it is closed
+	ServeRemoteAgents(*transport.StreamTransport[T]) error
+	// runs this server's agents in the runs of a shared server in another process, until the stream is closed
+	JoinSharedServer(*transport.StreamTransport[T]) error
+	// queue delivered messages in bounded per-agent inboxes instead of handling them immediately (default false)
+	EnableMailboxDelivery(int)
+	// injects a graph restricting which agents may message each other (default nil, unrestricted)
+	SetTopology(*topology.Graph)
+	// gives access to the communication graph (nil if unrestricted)
+	GetTopology() *topology.Graph
+	// injects a simulation of unreliable message delivery (default nil, reliable)
+	SetChannelModel(*network.ChannelModel)
+	// registers a destination for the structured event log
+	AddEventSink(events.EventSink)
+	// writes every subsequent message delivery to a log, encoding messages with the codec
+	RecordDeliveries(io.Writer, *message.CodecRegistry[T])
+	// stops recording deliveries, returning any error encountered while recording
+	StopRecording() error
+	// re-delivers a recorded log to the agents, returning the first divergence from the recording
+	Replay(io.Reader, *message.CodecRegistry[T]) error
+	// injects a destination for the diagnostics history as CSV, written at the end of each run
+	SetDiagnosticsCSVWriter(io.Writer)
+	// injects a destination for the diagnostics history as JSON, written at the end of each run
+	SetDiagnosticsJSONWriter(io.Writer)
+	// injects a registry naming message types in diagnostics (default nil, Go type names)
+	SetMessageTypeRegistry(*message.CodecRegistry[T])
 }
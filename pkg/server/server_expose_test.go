@@ -1,5 +1,7 @@
 package server
 
+import "io"
+
 func (s *BaseServer[T]) ExposeStartOfTurn() {
 	s.handleStartOfTurn()
 }
@@ -11,3 +13,7 @@ func (s *BaseServer[T]) ExposeEndOfTurn() {
 func (s *BaseServer[T]) ExposeEndListening() bool {
 	return s.endAgentListeningSession()
 }
+
+func (s *BaseServer[T]) ExposeConsoleWriter(w io.Writer) {
+	s.consoleWriter = w
+}
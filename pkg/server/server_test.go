@@ -1,12 +1,26 @@
 package server_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/MattSScott/basePlatformSOMAS/v2/internal/diagnosticsEngine"
 	"github.com/MattSScott/basePlatformSOMAS/v2/internal/testUtils"
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/events"
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/message"
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/network"
 	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/server"
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/topology"
+	"github.com/google/uuid"
 )
 
 func TestGenerateServer(t *testing.T) {
@@ -435,3 +449,1314 @@ func TestReportDiagnostics(t *testing.T) {
 	server.ReportMessagingDiagnostics()
 	server.Start()
 }
+
+func TestDeterministicAgentIDs(t *testing.T) {
+	numAgents := 5
+	server1 := testUtils.GenerateDeterministicTestServer(42, numAgents, 1, 1, time.Millisecond, 100)
+	server2 := testUtils.GenerateDeterministicTestServer(42, numAgents, 1, 1, time.Millisecond, 100)
+	ids1 := server1.ViewOrderedAgentIds()
+	ids2 := server2.ViewOrderedAgentIds()
+	if len(ids1) != numAgents {
+		t.Fatal("expected", numAgents, "ordered IDs, got:", len(ids1))
+	}
+	for i := range ids1 {
+		if ids1[i] != ids2[i] {
+			t.Errorf("Agent %d has ID %s in first run and %s in second run", i, ids1[i], ids2[i])
+		}
+	}
+	server3 := testUtils.GenerateDeterministicTestServer(43, numAgents, 1, 1, time.Millisecond, 100)
+	if server3.ViewOrderedAgentIds()[0] == ids1[0] {
+		t.Error("Different seeds produced the same agent ID")
+	}
+}
+
+func TestDeterministicMessageIDs(t *testing.T) {
+	server1 := testUtils.GenerateDeterministicTestServer(42, 2, 1, 1, time.Millisecond, 100)
+	server2 := testUtils.GenerateDeterministicTestServer(42, 2, 1, 1, time.Millisecond, 100)
+	sender1 := server1.AccessAgentByID(server1.ViewOrderedAgentIds()[0])
+	sender2 := server2.AccessAgentByID(server2.ViewOrderedAgentIds()[0])
+	for i := 0; i < 3; i++ {
+		id1, id2 := sender1.CreateBaseMessage().ID, sender2.CreateBaseMessage().ID
+		if id1 != id2 {
+			t.Errorf("Message %d has ID %s in first run and %s in second run", i, id1, id2)
+		}
+		if _, isAgent := server1.ViewAgentIdSet()[id1]; isAgent {
+			t.Error("Message ID repeats an agent ID")
+		}
+	}
+}
+
+func TestOrderedAgentIdsTrackRemoval(t *testing.T) {
+	server := testUtils.GenerateTestServer(3, 1, 1, time.Millisecond, 100)
+	ids := server.ViewOrderedAgentIds()
+	server.RemoveAgent(server.AccessAgentByID(ids[1]))
+	remaining := server.ViewOrderedAgentIds()
+	if len(remaining) != 2 || remaining[0] != ids[0] || remaining[1] != ids[2] {
+		t.Error("Ordered agent IDs not preserved after removal, got:", remaining)
+	}
+}
+
+func TestDeterministicDeliveryAndDrops(t *testing.T) {
+	numAgents := 3
+	bandwidth := 1
+	for run := 0; run < 3; run++ {
+		server := testUtils.GenerateDeterministicTestServer(7, numAgents, 1, 1, 100*time.Millisecond, bandwidth)
+		for _, ag := range server.GetAgentMap() {
+			ag.SetGoal(1)
+		}
+		ids := server.ViewOrderedAgentIds()
+		sender := server.AccessAgentByID(ids[0])
+		msg := sender.CreateTestMessage()
+		for _, id := range ids {
+			sender.SendMessage(msg, id)
+		}
+		server.ExposeEndListening()
+		if !server.AccessAgentByID(ids[0]).ReceivedMessage() {
+			t.Error("First queued message was not delivered")
+		}
+		for _, id := range ids[1:] {
+			if server.AccessAgentByID(id).GetCounter() != 0 {
+				t.Error("Message beyond bandwidth was delivered")
+			}
+		}
+		drops := server.GetDiagnosticEngine().GetNumberMessageDrops()
+		if drops != numAgents-bandwidth {
+			t.Errorf("Expected %d drops, got %d", numAgents-bandwidth, drops)
+		}
+	}
+}
+
+func TestDeterministicBandwidthResetsEachSession(t *testing.T) {
+	bandwidth := 2
+	server := testUtils.GenerateDeterministicTestServer(7, 4, 1, 1, 100*time.Millisecond, bandwidth)
+	ids := server.ViewOrderedAgentIds()
+	sender := server.AccessAgentByID(ids[0])
+	for session := 0; session < 2; session++ {
+		server.ExposeStartOfTurn()
+		for _, id := range ids[1:] {
+			sender.SendMessage(sender.CreateTestMessage(), id)
+		}
+		server.ExposeEndOfTurn()
+	}
+	for i, id := range ids[1:] {
+		expected := 0
+		if i < bandwidth {
+			expected = 2
+		}
+		if counter := server.AccessAgentByID(id).GetCounter(); counter != int32(expected) {
+			t.Errorf("Expected recipient %d to receive %d messages over two sessions, got %d", i, expected, counter)
+		}
+	}
+}
+
+func TestStartWithCancelledContext(t *testing.T) {
+	testServer := testUtils.GenerateTestServer(2, 3, 3, time.Millisecond, 100)
+	testServer.SetGameRunner(testServer)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := testServer.StartWithContext(ctx)
+	var haltErr *server.RunHaltedError
+	if !errors.As(err, &haltErr) {
+		t.Fatal("Expected RunHaltedError, got:", err)
+	}
+	if haltErr.Iteration != 0 || haltErr.Turn != -1 {
+		t.Errorf("Halted at iteration %d turn %d, expected iteration 0 turn -1", haltErr.Iteration, haltErr.Turn)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Error("Halt error does not wrap context cancellation")
+	}
+	if testServer.TurnCounter != 0 {
+		t.Error("Turns executed after cancellation:", testServer.TurnCounter)
+	}
+}
+
+func TestStopHaltsRun(t *testing.T) {
+	iterations := 3
+	turns := 2
+	stopAfter := 3
+	testServer := testUtils.GenerateTestStoppingServer(2, iterations, turns, stopAfter, time.Millisecond, 100)
+	testServer.SetGameRunner(testServer)
+	_, err := testServer.StartWithContext(context.Background())
+	var haltErr *server.RunHaltedError
+	if !errors.As(err, &haltErr) {
+		t.Fatal("Expected RunHaltedError, got:", err)
+	}
+	if haltErr.Iteration != 1 || haltErr.Turn != 0 {
+		t.Errorf("Halted at iteration %d turn %d, expected iteration 1 turn 0", haltErr.Iteration, haltErr.Turn)
+	}
+	if testServer.TurnCounter != stopAfter {
+		t.Error("Expected", stopAfter, "turns before stop, got:", testServer.TurnCounter)
+	}
+	if testServer.IterationEndCounter != 1 {
+		t.Error("Expected 1 completed iteration, got:", testServer.IterationEndCounter)
+	}
+}
+
+func TestStartWithContextCompletes(t *testing.T) {
+	testServer := testUtils.GenerateTestServer(2, 2, 2, time.Millisecond, 100)
+	testServer.SetGameRunner(testServer)
+	if _, err := testServer.StartWithContext(context.Background()); err != nil {
+		t.Error("Uncancelled run returned error:", err)
+	}
+	if testServer.TurnCounter != 4 {
+		t.Error("Expected 4 turns, got:", testServer.TurnCounter)
+	}
+}
+
+type bufferCloser struct {
+	*bytes.Buffer
+}
+
+func (bufferCloser) Close() error {
+	return nil
+}
+
+func TestSnapshotAndRestore(t *testing.T) {
+	numAgents := 3
+	iterations := 3
+	turns := 2
+	checkpoints := make(map[int]*bytes.Buffer)
+	original := testUtils.GenerateTestServer(numAgents, iterations, turns, time.Millisecond, 100)
+	original.SetGameRunner(original)
+	original.SetCheckpointWriter(func(iteration int) (io.WriteCloser, error) {
+		checkpoints[iteration] = &bytes.Buffer{}
+		return bufferCloser{checkpoints[iteration]}, nil
+	})
+	for _, ag := range original.GetAgentMap() {
+		ag.SetCounter(17)
+	}
+	original.Start()
+	if len(checkpoints) != iterations {
+		t.Fatal("Expected", iterations, "checkpoints, got:", len(checkpoints))
+	}
+
+	restored := testUtils.GenerateTestServer(0, 1, 1, time.Second, 1)
+	restored.SetGameRunner(restored)
+	err := restored.Restore(checkpoints[0], func() testUtils.ITestBaseAgent {
+		return testUtils.NewTestAgent(restored)
+	})
+	if err != nil {
+		t.Fatal("Restore failed:", err)
+	}
+	if restored.GetIterations() != iterations || restored.GetTurns() != turns {
+		t.Error("Restored server has wrong configuration")
+	}
+	originalIds := original.ViewOrderedAgentIds()
+	restoredIds := restored.ViewOrderedAgentIds()
+	if len(restoredIds) != numAgents {
+		t.Fatal("Expected", numAgents, "restored agents, got:", len(restoredIds))
+	}
+	for i, id := range restoredIds {
+		if id != originalIds[i] {
+			t.Errorf("Restored agent %d has ID %s, expected %s", i, id, originalIds[i])
+		}
+		if restored.AccessAgentByID(id).GetCounter() < 17 {
+			t.Error("Agent state not restored")
+		}
+	}
+	if history := restored.GetDiagnosticEngine().GetHistory(); len(history) != turns {
+		t.Error("Expected", turns, "turns of diagnostics history restored, got:", len(history))
+	}
+	restored.Start()
+	expectedTurns := (iterations - 1) * turns
+	if restored.TurnCounter != expectedTurns {
+		t.Error("Resumed run executed", restored.TurnCounter, "turns, expected:", expectedTurns)
+	}
+	if history := restored.GetDiagnosticEngine().GetHistory(); len(history) != iterations*turns {
+		t.Error("Expected diagnostics history of the whole run after resuming, got", len(history), "turns")
+	}
+}
+
+func TestRestoreInvalidSnapshot(t *testing.T) {
+	testServer := testUtils.GenerateTestServer(0, 1, 1, time.Millisecond, 100)
+	err := testServer.Restore(bytes.NewBufferString("not a snapshot"), func() testUtils.ITestBaseAgent {
+		return testUtils.NewTestAgent(testServer)
+	})
+	if err == nil {
+		t.Error("Restore accepted an invalid snapshot")
+	}
+}
+
+func TestFailedRestoreDiscardsSavedIds(t *testing.T) {
+	original := testUtils.GenerateTestServer(2, 1, 1, time.Millisecond, 100)
+	snapshot := &bytes.Buffer{}
+	if err := original.Snapshot(snapshot); err != nil {
+		t.Fatal("Snapshot failed:", err)
+	}
+	restored := testUtils.GenerateTestServer(0, 1, 1, time.Millisecond, 100)
+	err := restored.Restore(snapshot, func() testUtils.ITestBaseAgent {
+		return testUtils.NewTestAgent(testUtils.GenerateTestServer(0, 1, 1, time.Millisecond, 100))
+	})
+	if err == nil {
+		t.Fatal("Restore accepted agents not created by the restoring server")
+	}
+	next := testUtils.NewTestAgent(restored).GetID()
+	for _, id := range original.ViewOrderedAgentIds() {
+		if next == id {
+			t.Error("Saved ID leaked to an agent created after a failed restore")
+		}
+	}
+}
+
+func TestFailedRestoreLeavesServerUnchanged(t *testing.T) {
+	original := testUtils.GenerateTestServer(2, 5, 4, time.Millisecond, 100)
+	snapshot := &bytes.Buffer{}
+	if err := original.Snapshot(snapshot); err != nil {
+		t.Fatal("Snapshot failed:", err)
+	}
+	restored := testUtils.GenerateDeterministicTestServer(3, 3, 1, 1, time.Second, 10)
+	existingIds := restored.ViewOrderedAgentIds()
+	nextId := testUtils.NewTestAgent(testUtils.GenerateDeterministicTestServer(3, 3, 1, 1, time.Second, 10)).GetID()
+	created := 0
+	err := restored.Restore(snapshot, func() testUtils.ITestBaseAgent {
+		created++
+		if created == 2 {
+			return testUtils.NewTestAgent(testUtils.GenerateTestServer(0, 1, 1, time.Millisecond, 100))
+		}
+		return testUtils.NewTestAgent(restored)
+	})
+	if err == nil {
+		t.Fatal("Restore accepted an agent not created by the restoring server")
+	}
+	if restored.GetIterations() != 1 || restored.GetTurns() != 1 {
+		t.Error("Failed restore changed the server's configuration")
+	}
+	if ids := restored.ViewOrderedAgentIds(); !slices.Equal(ids, existingIds) {
+		t.Error("Failed restore changed the server's agents:", ids, "expected", existingIds)
+	}
+	if next := testUtils.NewTestAgent(restored).GetID(); next != nextId {
+		t.Error("Failed restore changed the server's ID sequence")
+	}
+}
+
+func TestDeterministicRestoreContinuesIdSequence(t *testing.T) {
+	original := testUtils.GenerateDeterministicTestServer(11, 2, 1, 1, time.Millisecond, 100)
+	snapshot := &bytes.Buffer{}
+	if err := original.Snapshot(snapshot); err != nil {
+		t.Fatal("Snapshot failed:", err)
+	}
+	nextOriginal := testUtils.NewTestAgent(original).GetID()
+	restored := testUtils.GenerateTestServer(0, 1, 1, time.Millisecond, 100)
+	err := restored.Restore(snapshot, func() testUtils.ITestBaseAgent {
+		return testUtils.NewTestAgent(restored)
+	})
+	if err != nil {
+		t.Fatal("Restore failed:", err)
+	}
+	if nextRestored := testUtils.NewTestAgent(restored).GetID(); nextRestored != nextOriginal {
+		t.Error("Restored ID generator diverged: got", nextRestored, "expected", nextOriginal)
+	}
+}
+
+func TestMessagesStampedWithTurn(t *testing.T) {
+	iterations := 2
+	turns := 3
+	testServer := testUtils.GenerateTestTurnStampServer(1, iterations, turns, time.Millisecond, 100)
+	testServer.SetGameRunner(testServer)
+	testServer.Start()
+	if len(testServer.MessageStamps) != iterations*turns {
+		t.Fatal("Expected", iterations*turns, "stamped messages, got:", len(testServer.MessageStamps))
+	}
+	for i, stamp := range testServer.MessageStamps {
+		expected := [2]int{i / turns, i % turns}
+		if stamp != expected {
+			t.Error("Message stamped with", stamp, "expected", expected)
+		}
+	}
+	if testServer.GetCurrentIteration() != -1 || testServer.GetCurrentTurn() != -1 {
+		t.Error("Turn stamp not reset after run")
+	}
+}
+
+func TestExpiredMessagesNotDelivered(t *testing.T) {
+	testServer := testUtils.GenerateTestServer(1, 1, 1, time.Millisecond, 100)
+	ag := testServer.AccessAgentByID(testServer.ViewOrderedAgentIds()[0])
+	expired := ag.CreateTestMessage()
+	expired.TTL = time.Millisecond
+	expired.SentAt = time.Now().Add(-time.Second)
+	testServer.DeliverMessage(expired, ag.GetID())
+	if ag.GetCounter() != 0 {
+		t.Error("Expired message was delivered")
+	}
+	fresh := ag.CreateTestMessage()
+	fresh.TTL = time.Minute
+	testServer.DeliverMessage(fresh, ag.GetID())
+	if ag.GetCounter() != 1 {
+		t.Error("Unexpired message was not delivered")
+	}
+}
+
+func TestStaleMessagesNotDelivered(t *testing.T) {
+	testServer := testUtils.GenerateDeterministicTestServer(1, 1, 1, 1, time.Millisecond, 100)
+	sink := createRecordingSink()
+	testServer.AddEventSink(sink)
+	ag := testServer.AccessAgentByID(testServer.ViewOrderedAgentIds()[0])
+	stale := ag.CreateTestMessage()
+	stale.Iteration, stale.Turn = 0, 0
+	testServer.DeliverMessage(stale, ag.GetID())
+	if ag.GetCounter() != 0 {
+		t.Error("Message delivered after the turn it was sent in ended")
+	}
+	if sink.counts[events.MessageDropped] != 1 {
+		t.Error("Stale message not reported as dropped")
+	}
+	// wall-clock TTLs are not reproducible, so are ignored in deterministic mode
+	outlived := ag.CreateTestMessage()
+	outlived.TTL = time.Millisecond
+	outlived.SentAt = time.Now().Add(-time.Second)
+	testServer.DeliverMessage(outlived, ag.GetID())
+	if ag.GetCounter() != 1 {
+		t.Error("Message outside a turn dropped for outliving its TTL in deterministic mode")
+	}
+}
+
+func TestMailboxOverflowDropsMessages(t *testing.T) {
+	capacity := 2
+	testServer := testUtils.GenerateTestServer(1, 1, 1, time.Millisecond, 100)
+	testServer.EnableMailboxDelivery(capacity)
+	ag := testServer.AccessAgentByID(testServer.ViewOrderedAgentIds()[0])
+	for i := 0; i < capacity+3; i++ {
+		testServer.DeliverMessage(ag.CreateTestMessage(), ag.GetID())
+	}
+	if overflows := testServer.GetDiagnosticEngine().GetNumberInboxOverflows(); overflows != 3 {
+		t.Error("Expected 3 inbox overflows, got:", overflows)
+	}
+	if handled := ag.ProcessInbox(); handled != capacity {
+		t.Error("Expected", capacity, "messages in inbox, got:", handled)
+	}
+}
+
+func TestGroupMembership(t *testing.T) {
+	testServer := testUtils.GenerateTestServer(3, 1, 1, time.Millisecond, 100)
+	ids := testServer.ViewOrderedAgentIds()
+	if _, err := testServer.CreateGroup("team", ids[0], uuid.New()); err == nil {
+		t.Error("Group created with an unknown agent")
+	}
+	if len(testServer.ViewGroups()) != 0 {
+		t.Error("Group with an unknown agent listed:", testServer.ViewGroups())
+	}
+	groupID, err := testServer.CreateGroup("team", ids[0], ids[1], ids[0])
+	if err != nil {
+		t.Fatal("Unable to create group:", err)
+	}
+	if members := testServer.ViewGroupMembers(groupID); len(members) != 2 {
+		t.Error("Expected 2 unique group members, got:", members)
+	}
+	if testServer.ViewGroups()[groupID] != "team" {
+		t.Error("Group not listed under its name")
+	}
+	if err := testServer.JoinGroup(groupID, ids[2]); err != nil {
+		t.Error("Unable to join group:", err)
+	}
+	if err := testServer.JoinGroup(groupID, uuid.New()); err == nil {
+		t.Error("Unknown agent joined group")
+	}
+	if err := testServer.LeaveGroup(groupID, ids[0]); err != nil {
+		t.Error("Unable to leave group:", err)
+	}
+	testServer.RemoveAgent(testServer.AccessAgentByID(ids[1]))
+	members := testServer.ViewGroupMembers(groupID)
+	if len(members) != 1 || members[0] != ids[2] {
+		t.Error("Expected only the joined agent to remain in group, got:", members)
+	}
+	testServer.DeleteGroup(groupID)
+	if err := testServer.JoinGroup(groupID, ids[0]); err == nil {
+		t.Error("Joined a deleted group")
+	}
+}
+
+func TestDeterministicGroupIDs(t *testing.T) {
+	server1 := testUtils.GenerateDeterministicTestServer(5, 2, 1, 1, time.Millisecond, 100)
+	server2 := testUtils.GenerateDeterministicTestServer(5, 2, 1, 1, time.Millisecond, 100)
+	groupID1, _ := server1.CreateGroup("team")
+	groupID2, _ := server2.CreateGroup("team")
+	if groupID1 != groupID2 {
+		t.Error("Group IDs differ between runs with the same seed")
+	}
+}
+
+func TestTopologyRestrictsMessaging(t *testing.T) {
+	testServer := testUtils.GenerateDeterministicTestServer(5, 4, 1, 1, 10*time.Millisecond, 100)
+	ids := testServer.ViewOrderedAgentIds()
+	graph := topology.CreateGraph()
+	graph.AddEdge(ids[0], ids[1])
+	graph.AddEdge(ids[0], ids[2])
+	testServer.SetTopology(graph)
+	sender := testServer.AccessAgentByID(ids[0])
+	sender.BroadcastMessage(sender.CreateTestMessage())
+	sender.SendMessage(sender.CreateTestMessage(), ids[3])
+	testServer.ExposeEndListening()
+	expectedCounts := []int32{0, 1, 1, 0}
+	for i, id := range ids {
+		if count := testServer.AccessAgentByID(id).GetCounter(); count != expectedCounts[i] {
+			t.Errorf("Agent %d received %d messages, expected %d", i, count, expectedCounts[i])
+		}
+	}
+	if drops := testServer.GetDiagnosticEngine().GetNumberMessageDrops(); drops != 1 {
+		t.Error("Expected message to non-neighbour recorded as 1 drop, got:", drops)
+	}
+	sender.SendSynchronousMessage(sender.CreateTestMessage(), ids[3])
+	if count := testServer.AccessAgentByID(ids[3]).GetCounter(); count != 0 {
+		t.Error("Synchronous message reached a non-neighbour")
+	}
+	if drops := testServer.GetDiagnosticEngine().GetNumberMessageDrops(); drops != 2 {
+		t.Error("Expected synchronous message to non-neighbour recorded as a drop, got:", drops, "drops")
+	}
+}
+
+func TestChannelModelEffects(t *testing.T) {
+	links := map[string]network.LinkModel{
+		"lossy":       {LossProbability: 1},
+		"duplicating": {DuplicationProbability: 1},
+	}
+	expectedCounts := map[string]int32{"lossy": 0, "duplicating": 2}
+	expectedEffects := map[string]diagnosticsEngine.NetworkEffect{
+		"lossy":       diagnosticsEngine.NetworkLoss,
+		"duplicating": diagnosticsEngine.NetworkDuplication,
+	}
+	for name, link := range links {
+		testServer := testUtils.GenerateDeterministicTestServer(1, 2, 1, 1, 10*time.Millisecond, 100)
+		testServer.SetChannelModel(network.CreateChannelModel(link, 1))
+		ids := testServer.ViewOrderedAgentIds()
+		sender := testServer.AccessAgentByID(ids[0])
+		sender.SendMessage(sender.CreateTestMessage(), ids[1])
+		testServer.ExposeEndListening()
+		if count := testServer.AccessAgentByID(ids[1]).GetCounter(); count != expectedCounts[name] {
+			t.Errorf("%s link delivered %d messages, expected %d", name, count, expectedCounts[name])
+		}
+		if testServer.GetDiagnosticEngine().GetNumberNetworkEffects(expectedEffects[name]) != 1 {
+			t.Error("Effect of", name, "link not recorded in diagnostics")
+		}
+	}
+}
+
+func TestChannelModelLatency(t *testing.T) {
+	latency := 50 * time.Millisecond
+	testServer := testUtils.GenerateTestServer(2, 1, 1, 200*time.Millisecond, 100)
+	testServer.SetChannelModel(network.CreateChannelModel(network.LinkModel{Latency: network.ConstantLatency(latency)}, 1))
+	ids := testServer.ViewOrderedAgentIds()
+	sender := testServer.AccessAgentByID(ids[0])
+	recipient := testServer.AccessAgentByID(ids[1])
+	recipient.SetGoal(1)
+	start := time.Now()
+	sender.SendMessage(sender.CreateTestMessage(), ids[1])
+	testServer.ExposeEndListening()
+	if !recipient.ReceivedMessage() {
+		t.Fatal("Delayed message not delivered")
+	}
+	if elapsed := time.Since(start); elapsed < latency {
+		t.Error("Message delivered after", elapsed, "expected at least", latency)
+	}
+	if testServer.GetDiagnosticEngine().GetNumberNetworkEffects(diagnosticsEngine.NetworkDelay) != 1 {
+		t.Error("Delay not recorded in diagnostics")
+	}
+}
+
+func TestDeterministicChannelModelIgnoresLatency(t *testing.T) {
+	testServer := testUtils.GenerateDeterministicTestServer(1, 2, 1, 1, 10*time.Millisecond, 100)
+	testServer.SetChannelModel(network.CreateChannelModel(network.LinkModel{Latency: network.ConstantLatency(10 * time.Millisecond), ReorderProbability: 1, ReorderDelay: 10 * time.Millisecond}, 1))
+	ids := testServer.ViewOrderedAgentIds()
+	sender := testServer.AccessAgentByID(ids[0])
+	for i := 0; i < 5; i++ {
+		sender.SendMessage(sender.CreateTestMessage(), ids[1])
+	}
+	testServer.ExposeEndListening()
+	if count := testServer.AccessAgentByID(ids[1]).GetCounter(); count != 5 {
+		t.Error("Recipient received", count, "messages, expected 5")
+	}
+	diagnostics := testServer.GetDiagnosticEngine()
+	if delays := diagnostics.GetNumberNetworkEffects(diagnosticsEngine.NetworkDelay); delays != 0 {
+		t.Error("Discarded delays reported in diagnostics:", delays)
+	}
+	if reorderings := diagnostics.GetNumberNetworkEffects(diagnosticsEngine.NetworkReordering); reorderings != 0 {
+		t.Error("Discarded reorderings reported in diagnostics:", reorderings)
+	}
+}
+
+type recordingSink struct {
+	lock         sync.Mutex
+	counts       map[events.EventType]int
+	messageTypes map[string]int
+}
+
+func createRecordingSink() *recordingSink {
+	return &recordingSink{counts: make(map[events.EventType]int), messageTypes: make(map[string]int)}
+}
+
+func (rs *recordingSink) Emit(event events.Event) {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	rs.counts[event.Type]++
+	if event.MessageType != "" {
+		rs.messageTypes[event.MessageType]++
+	}
+}
+
+func TestChannelModelLatencyFreesBandwidth(t *testing.T) {
+	bandwidth := 1
+	testServer := testUtils.GenerateTestServer(3, 1, 1, 200*time.Millisecond, bandwidth)
+	testServer.SetChannelModel(network.CreateChannelModel(network.LinkModel{Latency: network.ConstantLatency(50 * time.Millisecond)}, 1))
+	ids := testServer.ViewOrderedAgentIds()
+	sender := testServer.AccessAgentByID(ids[0])
+	sender.SendMessage(sender.CreateTestMessage(), ids[1])
+	time.Sleep(10 * time.Millisecond)
+	sender.SendMessage(sender.CreateTestMessage(), ids[2])
+	if drops := testServer.GetDiagnosticEngine().GetNumberMessageDrops(); drops != 0 {
+		t.Error("Message in transit held the sender's bandwidth, causing", drops, "drops")
+	}
+	testServer.ExposeEndListening()
+}
+
+func TestEventLog(t *testing.T) {
+	numAgents := 3
+	iterations := 2
+	turns := 2
+	sink := createRecordingSink()
+	testServer := testUtils.GenerateDeterministicTestServer(1, 0, iterations, turns, 10*time.Millisecond, 100)
+	testServer.AddEventSink(sink)
+	registry := message.CreateCodecRegistry[testUtils.ITestBaseAgent]()
+	registry.Register("test", &testUtils.TestMessage{})
+	testServer.SetMessageTypeRegistry(registry)
+	for i := 0; i < numAgents; i++ {
+		testServer.AddAgent(testUtils.NewTestAgent(testServer))
+	}
+	testServer.SetGameRunner(testServer)
+	testServer.Start()
+	testServer.RemoveAgent(testServer.AccessAgentByID(testServer.ViewOrderedAgentIds()[0]))
+	numTurns := iterations * turns
+	messagesPerTurn := numAgents * (numAgents - 1)
+	expectedCounts := map[events.EventType]int{
+		events.AgentAdded:       numAgents,
+		events.AgentRemoved:     1,
+		events.IterationStarted: iterations,
+		events.IterationEnded:   iterations,
+		events.TurnStarted:      numTurns,
+		events.TurnEnded:        numTurns,
+		events.MessageSent:      numTurns * messagesPerTurn,
+		events.MessageDelivered: numTurns * messagesPerTurn,
+		events.MessagingTimeout: numTurns,
+	}
+	for eventType, expected := range expectedCounts {
+		if sink.counts[eventType] != expected {
+			t.Errorf("Expected %d %s events, got %d", expected, eventType, sink.counts[eventType])
+		}
+	}
+	if len(sink.messageTypes) != 1 || sink.messageTypes["test"] != 2*numTurns*messagesPerTurn {
+		t.Error("Expected message events named by the registry, got:", sink.messageTypes)
+	}
+}
+
+func recordRequestExchange(t *testing.T, codec *message.CodecRegistry[testUtils.ITestBaseAgent], loseReply bool) *bytes.Buffer {
+	testServer := testUtils.GenerateDeterministicTestServer(3, 2, 1, 1, 10*time.Millisecond, 100)
+	log := &bytes.Buffer{}
+	testServer.RecordDeliveries(log, codec)
+	ids := testServer.ViewOrderedAgentIds()
+	if loseReply {
+		model := network.CreateChannelModel(network.LinkModel{}, 1)
+		model.SetLink(ids[1], ids[0], network.LinkModel{LossProbability: 1})
+		testServer.SetChannelModel(model)
+	}
+	requester := testServer.AccessAgentByID(ids[0])
+	testServer.ExposeStartOfTurn()
+	testServer.DeliverMessage(&testUtils.TestRequestMessage{BaseMessage: requester.CreateBaseMessage()}, ids[1])
+	testServer.ExposeEndListening()
+	if err := testServer.StopRecording(); err != nil {
+		t.Fatal(err)
+	}
+	return log
+}
+
+func TestRecordAndReplayDeliveries(t *testing.T) {
+	codec := message.CreateCodecRegistry[testUtils.ITestBaseAgent]()
+	codec.Register("request", &testUtils.TestRequestMessage{})
+	codec.Register("test", &testUtils.TestMessage{})
+	log := recordRequestExchange(t, codec, false)
+	if lines := bytes.Count(log.Bytes(), []byte("\n")); lines != 2 {
+		t.Fatalf("Expected request and reply to be recorded, got %d deliveries", lines)
+	}
+
+	replayServer := testUtils.GenerateDeterministicTestServer(3, 2, 1, 1, 10*time.Millisecond, 100)
+	if err := replayServer.Replay(bytes.NewReader(log.Bytes()), codec); err != nil {
+		t.Fatalf("Expected faithful replay, got %v", err)
+	}
+	requester := replayServer.AccessAgentByID(replayServer.ViewOrderedAgentIds()[0])
+	if requester.GetCounter() != 1 {
+		t.Errorf("Expected recorded reply to be handled, counter is %d", requester.GetCounter())
+	}
+}
+
+func TestReplayReportsDivergence(t *testing.T) {
+	codec := message.CreateCodecRegistry[testUtils.ITestBaseAgent]()
+	codec.Register("request", &testUtils.TestRequestMessage{})
+	codec.Register("test", &testUtils.TestMessage{})
+	log := recordRequestExchange(t, codec, false)
+	// drop the recorded reply, so the replayed agent's response has no counterpart
+	firstLine := log.Bytes()[:bytes.IndexByte(log.Bytes(), '\n')+1]
+
+	replayServer := testUtils.GenerateDeterministicTestServer(3, 2, 1, 1, 10*time.Millisecond, 100)
+	err := replayServer.Replay(bytes.NewReader(firstLine), codec)
+	var divergence *server.ReplayDivergenceError
+	if !errors.As(err, &divergence) {
+		t.Fatalf("Expected divergence error, got %v", err)
+	}
+	ids := replayServer.ViewOrderedAgentIds()
+	if divergence.Sequence != 0 || divergence.Sender != ids[1] || divergence.Recipient != ids[0] {
+		t.Errorf("Unexpected divergence reported: %v", divergence)
+	}
+}
+
+func TestReplayReportsMissingMessage(t *testing.T) {
+	codec := message.CreateCodecRegistry[testUtils.ITestBaseAgent]()
+	codec.Register("request", &testUtils.TestRequestMessage{})
+	codec.Register("test", &testUtils.TestMessage{})
+	log := recordRequestExchange(t, codec, false)
+
+	// in mailbox mode the replayed request is never handled, so the recorded reply is never sent
+	replayServer := testUtils.GenerateDeterministicTestServer(3, 2, 1, 1, 10*time.Millisecond, 100)
+	replayServer.EnableMailboxDelivery(1)
+	err := replayServer.Replay(bytes.NewReader(log.Bytes()), codec)
+	var divergence *server.ReplayDivergenceError
+	if !errors.As(err, &divergence) {
+		t.Fatalf("Expected divergence error, got %v", err)
+	}
+	ids := replayServer.ViewOrderedAgentIds()
+	if divergence.Sequence != 1 || divergence.Missing == "" || divergence.Sender != ids[1] {
+		t.Errorf("Expected recorded reply to be reported missing, got: %v", divergence)
+	}
+}
+
+func TestReplayMatchesRecordedDrops(t *testing.T) {
+	codec := message.CreateCodecRegistry[testUtils.ITestBaseAgent]()
+	codec.Register("request", &testUtils.TestRequestMessage{})
+	codec.Register("test", &testUtils.TestMessage{})
+	log := recordRequestExchange(t, codec, true)
+	if lines := bytes.Count(log.Bytes(), []byte("\n")); lines != 2 {
+		t.Fatalf("Expected request and lost reply to be recorded, got %d deliveries", lines)
+	}
+
+	replayServer := testUtils.GenerateDeterministicTestServer(3, 2, 1, 1, 10*time.Millisecond, 100)
+	if err := replayServer.Replay(bytes.NewReader(log.Bytes()), codec); err != nil {
+		t.Fatalf("Expected lost reply to match the recording, got %v", err)
+	}
+	if requester := replayServer.AccessAgentByID(replayServer.ViewOrderedAgentIds()[0]); requester.GetCounter() != 0 {
+		t.Error("Recorded drop was delivered during replay")
+	}
+}
+
+func TestDiagnosticsHistoryExportedAtEndOfRun(t *testing.T) {
+	iterations := 2
+	turns := 3
+	testServer := testUtils.GenerateDeterministicTestServer(1, 3, iterations, turns, 10*time.Millisecond, 100)
+	testServer.SetGameRunner(testServer)
+	var csvOutput bytes.Buffer
+	testServer.SetDiagnosticsCSVWriter(&csvOutput)
+	testServer.Start()
+	if rows := bytes.Count(csvOutput.Bytes(), []byte("\n")); rows != iterations*turns+1 {
+		t.Errorf("Expected header and %d turns in export, got %d rows", iterations*turns, rows)
+	}
+	summary := testServer.GetDiagnosticEngine().GetHistorySummary()
+	if summary.Turns != iterations*turns || summary.TotalSent != iterations*turns*3*2 {
+		t.Errorf("Unexpected history summary: %+v", summary)
+	}
+	testServer.Start()
+	if testServer.GetDiagnosticEngine().GetHistorySummary().Turns != iterations*turns {
+		t.Error("History not cleared at start of fresh run")
+	}
+}
+
+func TestDiagnosticsBreakdownBySenderAndType(t *testing.T) {
+	bandwidth := 1
+	testServer := testUtils.GenerateDeterministicTestServer(2, 3, 1, 1, 10*time.Millisecond, bandwidth)
+	registry := message.CreateCodecRegistry[testUtils.ITestBaseAgent]()
+	registry.Register("test", &testUtils.TestMessage{})
+	testServer.SetMessageTypeRegistry(registry)
+	ids := testServer.ViewOrderedAgentIds()
+	sender := testServer.AccessAgentByID(ids[0])
+	sender.BroadcastMessage(sender.CreateTestMessage())
+	engine := testServer.GetDiagnosticEngine()
+	expected := diagnosticsEngine.MessageCounts{Sent: 2, Delivered: bandwidth, Dropped: 2 - bandwidth}
+	if counts := engine.GetSenderBreakdown()[ids[0]]; counts != expected {
+		t.Errorf("Expected sender counts %v, got %v", expected, counts)
+	}
+	if counts := engine.GetMessageTypeBreakdown()["test"]; counts != expected {
+		t.Errorf("Expected counts %v under registered type name, got %v", expected, counts)
+	}
+	if len(engine.GetRecipientBreakdown()) != 2 {
+		t.Error("Expected counts for both recipients")
+	}
+}
+
+func TestTimingDiagnostics(t *testing.T) {
+	testServer := testUtils.GenerateDeterministicTestServer(4, 2, 1, 1, 10*time.Millisecond, 100)
+	ids := testServer.ViewOrderedAgentIds()
+	sender := testServer.AccessAgentByID(ids[0])
+	recipient := testServer.AccessAgentByID(ids[1])
+	recipient.SetGoal(1)
+	testServer.ExposeStartOfTurn()
+	sender.SendSynchronousMessage(sender.CreateTestMessage(), ids[1])
+	testServer.ExposeEndListening()
+	engine := testServer.GetDiagnosticEngine()
+	if engine.GetDeliveryLatencies().Count != 1 {
+		t.Error("Delivery latency not recorded")
+	}
+	if engine.GetAgentHandlerDurations()[ids[1]].Count != 1 {
+		t.Error("Handler duration not recorded against recipient")
+	}
+	completeTimes := engine.GetAgentMessagingCompleteTimes()
+	if _, ok := completeTimes[ids[1]]; !ok || len(completeTimes) != 1 {
+		t.Errorf("Expected only recipient's messaging complete time, got %v", completeTimes)
+	}
+}
+
+type countingReporter struct {
+	turns, iterations, runs int
+}
+
+func (cr *countingReporter) ReportTurn(server.TurnRecord, int, server.DiagnosticsData) {
+	cr.turns++
+}
+
+func (cr *countingReporter) ReportIteration(int, []server.TurnRecord) {
+	cr.iterations++
+}
+
+func (cr *countingReporter) ReportRun(server.HistorySummary) {
+	cr.runs++
+}
+
+func TestDiagnosticsReporters(t *testing.T) {
+	iterations, turns := 2, 2
+	testServer := testUtils.GenerateDeterministicTestServer(1, 3, iterations, turns, 10*time.Millisecond, 100)
+	testServer.SetGameRunner(testServer)
+	counter := &countingReporter{}
+	var jsonOutput, csvOutput, consoleOutput, summaryOutput bytes.Buffer
+	jsonReporter := server.CreateJSONReporter(&jsonOutput)
+	csvReporter := server.CreateCSVReporter(&csvOutput)
+	testServer.AddDiagnosticsReporter(counter)
+	testServer.AddDiagnosticsReporter(jsonReporter)
+	testServer.AddDiagnosticsReporter(csvReporter)
+	testServer.AddDiagnosticsReporter(server.CreateConsoleReporter(&consoleOutput))
+	testServer.AddDiagnosticsReporter(server.CreateSummaryReporter(&summaryOutput))
+	testServer.Start()
+	if counter.turns != iterations*turns || counter.iterations != iterations || counter.runs != 1 {
+		t.Errorf("Unexpected number of reports: %+v", counter)
+	}
+	if jsonReporter.Err() != nil || csvReporter.Err() != nil {
+		t.Fatal("Reporters failed to write")
+	}
+	reports := iterations*turns + iterations + 1
+	if lines := bytes.Count(jsonOutput.Bytes(), []byte("\n")); lines != reports {
+		t.Errorf("Expected %d JSON reports, got %d", reports, lines)
+	}
+	if lines := bytes.Count(csvOutput.Bytes(), []byte("\n")); lines != reports+1 {
+		t.Errorf("Expected header and %d CSV rows, got %d", reports, lines)
+	}
+	if !bytes.HasPrefix(csvOutput.Bytes(), []byte("scope,iteration,turn")) || !bytes.Contains(csvOutput.Bytes(), []byte("\nrun,,,,24,24,0,")) {
+		t.Errorf("Unexpected CSV output:\n%s", csvOutput.String())
+	}
+	if !bytes.Contains(consoleOutput.Bytes(), []byte("(6 delivered, 0 dropped)")) {
+		t.Errorf("Unexpected console output:\n%s", consoleOutput.String())
+	}
+	if lines := bytes.Count(consoleOutput.Bytes(), []byte("\n")); lines != 2*iterations*turns {
+		t.Errorf("Expected only per-turn lines from console reporter, got:\n%s", consoleOutput.String())
+	}
+	if lines := bytes.Count(summaryOutput.Bytes(), []byte("\n")); lines != iterations+1 || !bytes.HasPrefix(summaryOutput.Bytes(), []byte("iteration 0: 12 messages")) {
+		t.Errorf("Unexpected summary output:\n%s", summaryOutput.String())
+	}
+}
+
+func TestReportMessagingDiagnosticsIsIdempotent(t *testing.T) {
+	testServer := testUtils.GenerateDeterministicTestServer(1, 3, 1, 1, 10*time.Millisecond, 100)
+	testServer.SetGameRunner(testServer)
+	testServer.ReportMessagingDiagnostics()
+	testServer.ReportMessagingDiagnostics()
+	output := &bytes.Buffer{}
+	testServer.ExposeConsoleWriter(output)
+	testServer.Start()
+	expected := "100.000000% of messages successfully sent (6 delivered, 0 dropped)\n" +
+		"0.000000% of agents successfully ended messaging (0 ended, 3 total)\n"
+	if output.String() != expected {
+		t.Errorf("Expected a single turn report on the console, got:\n%s", output)
+	}
+}
+
+func TestAgentLifecycleHooks(t *testing.T) {
+	expectedCalls := []string{
+		"added",
+		"iterationStart 0", "turnStart 0.0", "turnEnd 0.0", "turnStart 0.1", "turnEnd 0.1", "iterationEnd 0",
+		"iterationStart 1", "turnStart 1.0", "turnEnd 1.0", "turnStart 1.1", "turnEnd 1.1", "iterationEnd 1",
+		"removed",
+	}
+	for _, parallel := range []bool{false, true} {
+		testServer := testUtils.GenerateDeterministicTestServer(1, 0, 2, 2, 10*time.Millisecond, 100)
+		testServer.SetGameRunner(testServer)
+		testServer.SetParallelAgentHooks(parallel)
+		hookAgents := []*testUtils.TestHookAgent{}
+		for i := 0; i < 3; i++ {
+			hookAgent := testUtils.NewTestHookAgent(testServer)
+			testServer.AddAgent(hookAgent)
+			testServer.AddAgent(hookAgent)
+			hookAgents = append(hookAgents, hookAgent)
+		}
+		testServer.Start()
+		for _, hookAgent := range hookAgents {
+			testServer.RemoveAgent(hookAgent)
+			calls := hookAgent.Calls()
+			if len(calls) != len(expectedCalls) {
+				t.Fatalf("Expected hooks %v, got %v", expectedCalls, calls)
+			}
+			for i := range calls {
+				if calls[i] != expectedCalls[i] {
+					t.Errorf("Expected hook %q at position %d, got %q", expectedCalls[i], i, calls[i])
+				}
+			}
+		}
+	}
+}
+
+func TestTurnPhases(t *testing.T) {
+	iterations, turns, numAgents := 1, 2, 3
+	testServer := testUtils.GenerateDeterministicTestServer(1, numAgents, iterations, turns, time.Second, 100)
+	testServer.SetGameRunner(testServer)
+	sink := createRecordingSink()
+	testServer.AddEventSink(sink)
+	phasesRun := []string{}
+	testServer.SetTurnPhases(
+		server.TurnPhase[testUtils.ITestBaseAgent]{
+			Name:    "message",
+			Timeout: 5 * time.Millisecond,
+			AgentAction: func(ag testUtils.ITestBaseAgent, iteration, turn int) {
+				ag.BroadcastMessage(ag.CreateTestMessage())
+			},
+		},
+		server.TurnPhase[testUtils.ITestBaseAgent]{
+			Name:    "resolve",
+			Timeout: 5 * time.Millisecond,
+			Run: func(iteration, turn int) error {
+				phasesRun = append(phasesRun, "resolve")
+				return nil
+			},
+		},
+	)
+	start := time.Now()
+	testServer.Start()
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Phase timeouts not applied, run took %v", elapsed)
+	}
+	numPhases := iterations * turns * 2
+	if sink.counts[events.PhaseStarted] != numPhases || sink.counts[events.PhaseEnded] != numPhases {
+		t.Errorf("Expected %d phases, got %d started and %d ended", numPhases, sink.counts[events.PhaseStarted], sink.counts[events.PhaseEnded])
+	}
+	if sink.counts[events.MessagingTimeout] != numPhases {
+		t.Errorf("Expected a messaging session per phase, got %d", sink.counts[events.MessagingTimeout])
+	}
+	if len(phasesRun) != iterations*turns {
+		t.Errorf("Expected resolve phase once per turn, got %d", len(phasesRun))
+	}
+	for _, record := range testServer.GetDiagnosticEngine().GetHistory() {
+		if record.Delivered != numAgents*(numAgents-1) {
+			t.Errorf("Expected messages from every agent in turn %d, got %d", record.Turn, record.Delivered)
+		}
+	}
+}
+
+func TestFailingTurnPhase(t *testing.T) {
+	testServer := testUtils.GenerateDeterministicTestServer(1, 3, 2, 3, time.Second, 100)
+	testServer.SetGameRunner(testServer)
+	sink := createRecordingSink()
+	testServer.AddEventSink(sink)
+	resolved := 0
+	testServer.SetTurnPhases(
+		server.TurnPhase[testUtils.ITestBaseAgent]{
+			Name:    "act",
+			Timeout: 5 * time.Millisecond,
+			Run: func(iteration, turn int) error {
+				if turn == 1 {
+					return errRunnerFailed
+				}
+				return nil
+			},
+		},
+		server.TurnPhase[testUtils.ITestBaseAgent]{
+			Name:    "resolve",
+			Timeout: 5 * time.Millisecond,
+			Run: func(iteration, turn int) error {
+				resolved++
+				return nil
+			},
+		},
+	)
+	result, err := testServer.StartWithContext(context.Background())
+	if !errors.Is(err, errRunnerFailed) || !errors.Is(result.Err, errRunnerFailed) {
+		t.Fatalf("Expected phase error to halt run, got %v", err)
+	}
+	if !strings.Contains(err.Error(), `phase "act"`) {
+		t.Errorf("Expected error to name the failing phase, got %q", err)
+	}
+	if resolved != 1 || result.CompletedTurns() != 1 || len(result.Turns) != 2 {
+		t.Errorf("Unexpected progress after failed phase: resolved %d, %+v", resolved, result)
+	}
+	if sink.counts[events.MessagingTimeout] != 3 {
+		t.Errorf("Expected failed phase to end its messaging session, got %d sessions", sink.counts[events.MessagingTimeout])
+	}
+}
+
+func TestTurnPhasesPassThroughMiddleware(t *testing.T) {
+	testServer := testUtils.GenerateDeterministicTestServer(1, 3, 2, 3, time.Second, 100)
+	testServer.SetGameRunner(testServer)
+	sink := createRecordingSink()
+	testServer.AddEventSink(sink)
+	timedTurns := 0
+	testServer.UseRunnerMiddleware(
+		server.RecoveryMiddleware(),
+		server.TimingMiddleware(func(call string, iteration, turn int, elapsed time.Duration) {
+			if call == server.CallTurn {
+				timedTurns++
+			}
+		}),
+	)
+	testServer.SetTurnPhases(
+		server.TurnPhase[testUtils.ITestBaseAgent]{
+			Name:    "act",
+			Timeout: 5 * time.Millisecond,
+			Run: func(iteration, turn int) error {
+				if turn == 1 {
+					panic("phase failed")
+				}
+				return nil
+			},
+		},
+		server.TurnPhase[testUtils.ITestBaseAgent]{
+			Name:    "resolve",
+			Timeout: 5 * time.Millisecond,
+		},
+	)
+	result, err := testServer.StartWithContext(context.Background())
+	var panicErr *server.RunnerPanicError
+	if !errors.As(err, &panicErr) || panicErr.Call != server.CallTurn || panicErr.Turn != 1 {
+		t.Fatalf("Expected panicking phase to be recovered as a failed turn, got %v", err)
+	}
+	if timedTurns != 1 || result.CompletedTurns() != 1 || len(result.Turns) != 2 {
+		t.Errorf("Expected each phased turn to pass through middleware once, got %d timed turns and %+v", timedTurns, result)
+	}
+	if sink.counts[events.PhaseStarted] != 3 || sink.counts[events.MessagingTimeout] != 3 {
+		t.Errorf("Expected interrupted phase's session to be ended, got %d phases and %d sessions", sink.counts[events.PhaseStarted], sink.counts[events.MessagingTimeout])
+	}
+}
+
+func runScheduledTurn(scheduler server.Scheduler[testUtils.ITestBaseAgent], numAgents int) (*testUtils.TestServer, []*testUtils.TestHookAgent) {
+	testServer := testUtils.GenerateDeterministicTestServer(1, 0, 1, 1, 5*time.Millisecond, 100)
+	testServer.SetGameRunner(testServer)
+	testServer.SetScheduler(scheduler)
+	hookAgents := []*testUtils.TestHookAgent{}
+	for i := 0; i < numAgents; i++ {
+		hookAgent := testUtils.NewTestHookAgent(testServer)
+		testServer.AddAgent(hookAgent)
+		hookAgents = append(hookAgents, hookAgent)
+	}
+	testServer.Start()
+	return testServer, hookAgents
+}
+
+func hasCall(calls []string, call string) bool {
+	for _, c := range calls {
+		if c == call {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSequentialScheduler(t *testing.T) {
+	testServer, hookAgents := runScheduledTurn(server.CreateSequentialScheduler[testUtils.ITestBaseAgent](), 5)
+	order := testServer.GetActivationOrder()
+	for i, id := range testServer.ViewOrderedAgentIds() {
+		if order[i] != id {
+			t.Fatalf("Expected activation in order of addition, got %v", order)
+		}
+	}
+	for _, hookAgent := range hookAgents {
+		if !hasCall(hookAgent.Calls(), "step 0.0") {
+			t.Errorf("Agent not stepped: %v", hookAgent.Calls())
+		}
+	}
+}
+
+func TestRandomSchedulerIsSeeded(t *testing.T) {
+	numAgents := 8
+	server1, _ := runScheduledTurn(server.CreateRandomScheduler[testUtils.ITestBaseAgent](3), numAgents)
+	server2, _ := runScheduledTurn(server.CreateRandomScheduler[testUtils.ITestBaseAgent](3), numAgents)
+	order1, order2 := server1.GetActivationOrder(), server2.GetActivationOrder()
+	if len(order1) != numAgents {
+		t.Fatalf("Expected %d activations, got %d", numAgents, len(order1))
+	}
+	shuffled := false
+	for i, id := range server1.ViewOrderedAgentIds() {
+		if order1[i] != order2[i] {
+			t.Fatal("Activation order differs between runs with the same seed")
+		}
+		shuffled = shuffled || order1[i] != id
+	}
+	if !shuffled {
+		t.Error("Activation order not shuffled")
+	}
+}
+
+func TestStagedScheduler(t *testing.T) {
+	numAgents := 3
+	testServer, hookAgents := runScheduledTurn(server.CreateStagedScheduler[testUtils.ITestBaseAgent]("perceive", "act"), numAgents)
+	order := testServer.GetActivationOrder()
+	if len(order) != 2*numAgents || order[0] != order[numAgents] {
+		t.Errorf("Expected every agent to complete each stage in turn, got %v", order)
+	}
+	for _, hookAgent := range hookAgents {
+		calls := hookAgent.Calls()
+		if !hasCall(calls, "perceive 0.0") || !hasCall(calls, "act 0.0") || hasCall(calls, "step 0.0") {
+			t.Errorf("Unexpected stages run: %v", calls)
+		}
+	}
+}
+
+func TestSimultaneousScheduler(t *testing.T) {
+	numAgents := 3
+	_, hookAgents := runScheduledTurn(server.CreateSimultaneousScheduler[testUtils.ITestBaseAgent](), numAgents)
+	for _, hookAgent := range hookAgents {
+		calls := hookAgent.Calls()
+		if !hasCall(calls, "step 0.0") || !hasCall(calls, "advance 0.0") {
+			t.Errorf("Expected step and advance, got %v", calls)
+		}
+	}
+}
+
+func TestConcurrentScheduler(t *testing.T) {
+	numAgents := 20
+	testServer, hookAgents := runScheduledTurn(server.CreateConcurrentScheduler[testUtils.ITestBaseAgent](4), numAgents)
+	activated := make(map[uuid.UUID]struct{})
+	for _, id := range testServer.GetActivationOrder() {
+		activated[id] = struct{}{}
+	}
+	if len(activated) != numAgents || len(testServer.GetActivationOrder()) != numAgents {
+		t.Error("Expected every agent to be activated exactly once")
+	}
+	for _, hookAgent := range hookAgents {
+		if !hasCall(hookAgent.Calls(), "step 0.0") {
+			t.Errorf("Agent not stepped: %v", hookAgent.Calls())
+		}
+	}
+}
+
+func TestStopConditionEndsRun(t *testing.T) {
+	testServer := testUtils.GenerateDeterministicTestServer(1, 3, 3, 5, 5*time.Millisecond, 100)
+	testServer.SetGameRunner(testServer)
+	testServer.AddStopCondition(server.NoAgentsRemain[testUtils.ITestBaseAgent]())
+	testServer.AddStopCondition(server.AnyAgentSatisfies("counter reached", func(ag testUtils.ITestBaseAgent) bool {
+		return ag.GetCounter() >= 4
+	}))
+	result := testServer.Start()
+	if testServer.GetStopReason() != "counter reached" || result.StopReason != "counter reached" {
+		t.Errorf("Expected run to stop with reason, got %q", testServer.GetStopReason())
+	}
+	if turns := len(testServer.GetDiagnosticEngine().GetHistory()); turns != 2 {
+		t.Errorf("Expected run to stop after 2 turns, ran %d", turns)
+	}
+	if testServer.IterationEndCounter != 1 {
+		t.Errorf("Expected the interrupted iteration to end, %d iterations ended", testServer.IterationEndCounter)
+	}
+}
+
+func TestIterationOnlyStopCondition(t *testing.T) {
+	iterations := 3
+	testServer := testUtils.GenerateDeterministicTestServer(1, 2, iterations, 5, 5*time.Millisecond, 100)
+	testServer.SetGameRunner(testServer)
+	testServer.AddStopCondition(server.StopCondition[testUtils.ITestBaseAgent]{
+		Reason:        "single turn",
+		Predicate:     func(map[uuid.UUID]testUtils.ITestBaseAgent) bool { return true },
+		IterationOnly: true,
+	})
+	result := testServer.Start()
+	if testServer.GetStopReason() != "" || result.StopReason != "" {
+		t.Errorf("Iteration-only condition recorded as run stop reason %q", testServer.GetStopReason())
+	}
+	if turns := len(testServer.GetDiagnosticEngine().GetHistory()); turns != iterations {
+		t.Errorf("Expected one turn per iteration, ran %d", turns)
+	}
+	if len(result.IterationStopReasons) != iterations || result.IterationStopReasons[iterations-1] != "single turn" {
+		t.Errorf("Expected every iteration's stop reason in result, got %v", result.IterationStopReasons)
+	}
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(encoded, []byte(`"iterationStopReasons":{"0":"single turn"`)) {
+		t.Errorf("Unexpected JSON encoding of result: %s", encoded)
+	}
+}
+
+func TestCheckpointRecordsStop(t *testing.T) {
+	testServer := testUtils.GenerateDeterministicTestServer(1, 2, 3, 2, 5*time.Millisecond, 100)
+	testServer.SetGameRunner(testServer)
+	testServer.AddStopCondition(server.AnyAgentSatisfies("counter reached", func(ag testUtils.ITestBaseAgent) bool {
+		return ag.GetCounter() >= 2
+	}))
+	checkpoints := make(map[int]*bytes.Buffer)
+	testServer.SetCheckpointWriter(func(iteration int) (io.WriteCloser, error) {
+		checkpoints[iteration] = &bytes.Buffer{}
+		return bufferCloser{checkpoints[iteration]}, nil
+	})
+	testServer.Start()
+	if len(checkpoints) != 1 {
+		t.Fatal("Expected a checkpoint of the stopped iteration, got:", len(checkpoints))
+	}
+	restored := testUtils.GenerateTestServer(0, 1, 1, time.Second, 1)
+	restored.SetGameRunner(restored)
+	err := restored.Restore(checkpoints[0], func() testUtils.ITestBaseAgent {
+		return testUtils.NewTestAgent(restored)
+	})
+	if err != nil {
+		t.Fatal("Restore failed:", err)
+	}
+	if restored.GetStopReason() != "counter reached" {
+		t.Errorf("Expected stop reason in checkpoint, got %q", restored.GetStopReason())
+	}
+	if resumed := restored.Start(); resumed.CompletedIterations != 3 {
+		t.Errorf("Expected checkpoint of stopped run to start afresh, completed %d iterations", resumed.CompletedIterations)
+	}
+}
+
+var errRunnerFailed = errors.New("runner failed")
+
+// fails on the given turn of the first iteration
+type failingRunner struct {
+	failOnTurn int
+	turnsRun   int
+}
+
+func (fr *failingRunner) RunStartOfIteration(int) error {
+	return nil
+}
+
+func (fr *failingRunner) RunTurn(ctx context.Context, iteration, turn int) error {
+	fr.turnsRun++
+	if turn == fr.failOnTurn {
+		return errRunnerFailed
+	}
+	return nil
+}
+
+func (fr *failingRunner) RunEndOfIteration(int) error {
+	return nil
+}
+
+func TestRunResult(t *testing.T) {
+	iterations, turns := 2, 3
+	testServer := testUtils.GenerateDeterministicTestServer(1, 2, iterations, turns, 5*time.Millisecond, 100)
+	testServer.SetGameRunner(testServer)
+	testServer.AddStopCondition(server.AnyAgentSatisfies("never", func(testUtils.ITestBaseAgent) bool { return false }))
+	result := testServer.Start()
+	if result.Err != nil || result.StopReason != "" {
+		t.Errorf("Unexpected failure of complete run: %+v", result)
+	}
+	if result.CompletedIterations != iterations || result.CompletedTurns() != iterations*turns || len(result.Turns) != iterations*turns {
+		t.Errorf("Unexpected progress in result: %+v", result)
+	}
+	last := result.Turns[len(result.Turns)-1]
+	if last.Iteration != iterations-1 || last.Turn != turns-1 || last.MessagingComplete || last.AgentsFinishedMessaging != 0 {
+		t.Errorf("Unexpected status of last turn: %+v", last)
+	}
+}
+
+func TestFallibleGameRunner(t *testing.T) {
+	testServer := testUtils.GenerateDeterministicTestServer(1, 2, 2, 3, 5*time.Millisecond, 100)
+	runner := &failingRunner{failOnTurn: 1}
+	testServer.SetFallibleGameRunner(runner)
+	result, err := testServer.StartWithContext(context.Background())
+	if !errors.Is(err, errRunnerFailed) || !errors.Is(result.Err, errRunnerFailed) {
+		t.Fatalf("Expected runner error to halt run, got %v", err)
+	}
+	if runner.turnsRun != 2 || result.CompletedIterations != 0 || result.CompletedTurns() != 1 || len(result.Turns) != 2 {
+		t.Errorf("Unexpected progress after failure: %+v", result)
+	}
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(encoded, []byte(`"completedTurns":1`)) || !bytes.Contains(encoded, []byte(errRunnerFailed.Error())) {
+		t.Errorf("Unexpected JSON encoding of result: %s", encoded)
+	}
+}
+
+type panickingRunner struct{}
+
+func (panickingRunner) RunStartOfIteration(int) {}
+
+func (panickingRunner) RunTurn(int, int) {
+	panic("turn exploded")
+}
+
+func (panickingRunner) RunEndOfIteration(int) {}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	testServer := testUtils.GenerateDeterministicTestServer(1, 2, 2, 2, 5*time.Millisecond, 100)
+	testServer.SetGameRunner(panickingRunner{})
+	testServer.UseRunnerMiddleware(server.RecoveryMiddleware())
+	result := testServer.Start()
+	var panicErr *server.RunnerPanicError
+	if !errors.As(result.Err, &panicErr) {
+		t.Fatalf("Expected recovered panic, got %v", result.Err)
+	}
+	if panicErr.Call != server.CallTurn || panicErr.Iteration != 0 || panicErr.Turn != 0 || panicErr.Value != "turn exploded" {
+		t.Errorf("Unexpected panic error: %v", panicErr)
+	}
+}
+
+func TestTimingAndLoggingMiddleware(t *testing.T) {
+	iterations, turns := 2, 3
+	testServer := testUtils.GenerateDeterministicTestServer(1, 2, iterations, turns, 5*time.Millisecond, 100)
+	testServer.SetGameRunner(testServer)
+	calls := []string{}
+	var logOutput bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logOutput, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	testServer.UseRunnerMiddleware(
+		server.TimingMiddleware(func(call string, iteration, turn int, elapsed time.Duration) {
+			calls = append(calls, call)
+		}),
+		server.LoggingMiddleware(logger),
+	)
+	testServer.Start()
+	expectedCalls := iterations * (turns + 2)
+	if len(calls) != expectedCalls || calls[0] != server.CallStartOfIteration || calls[1] != server.CallTurn {
+		t.Errorf("Unexpected timed calls: %v", calls)
+	}
+	if lines := bytes.Count(logOutput.Bytes(), []byte("game runner call completed")); lines != expectedCalls {
+		t.Errorf("Expected %d logged calls, got %d", expectedCalls, lines)
+	}
+}
+
+func TestInvariantMiddlewareOrdering(t *testing.T) {
+	testServer := testUtils.GenerateDeterministicTestServer(1, 2, 2, 2, 5*time.Millisecond, 100)
+	testServer.SetGameRunner(testServer)
+	errBroken := errors.New("counter too high")
+	order := []string{}
+	recordOrder := func(name string) server.RunnerMiddleware {
+		return server.TimingMiddleware(func(string, int, int, time.Duration) {
+			order = append(order, name)
+		})
+	}
+	testServer.UseRunnerMiddleware(recordOrder("outer"), recordOrder("inner"))
+	testServer.UseRunnerMiddleware(server.InvariantMiddleware("bounded turns", func() error {
+		if testServer.TurnCounter > 2 {
+			return errBroken
+		}
+		return nil
+	}))
+	result := testServer.Start()
+	if !errors.Is(result.Err, errBroken) {
+		t.Fatalf("Expected invariant violation, got %v", result.Err)
+	}
+	if result.CompletedIterations != 1 || result.CompletedTurns() != 2 {
+		t.Errorf("Expected run to halt in the second iteration, got %+v", result)
+	}
+	if len(order) < 2 || order[0] != "inner" || order[1] != "outer" {
+		t.Errorf("Expected inner middleware to complete first, got %v", order)
+	}
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/MattSScott/basePlatformSOMAS/v2/internal/diagnosticsEngine"
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/agent"
+	"github.com/google/uuid"
+)
+
+// serialised form of an agent within a server snapshot
+type agentSnapshot struct {
+	ID uuid.UUID `json:"id"`
+	// nil unless the agent implements agent.Snapshotter
+	State []byte `json:"state,omitempty"`
+}
+
+// serialised form of a server, written by Snapshot and read by Restore
+type serverSnapshot struct {
+	Iterations          int             `json:"iterations"`
+	Turns               int             `json:"turns"`
+	TurnTimeout         time.Duration   `json:"turnTimeout"`
+	MessageBandwidth    int             `json:"messageBandwidth"`
+	CompletedIterations int             `json:"completedIterations"`
+	StopReason          string          `json:"stopReason,omitempty"`
+	Deterministic       bool            `json:"deterministic"`
+	Seed                int64           `json:"seed"`
+	GeneratedIDs        int             `json:"generatedIDs"`
+	GeneratedMessageIDs int             `json:"generatedMessageIDs"`
+	Agents              []agentSnapshot `json:"agents"`
+	// diagnostics of the turns completed so far, so that a resumed run reports the whole run
+	DiagnosticsHistory []diagnosticsEngine.TurnRecord `json:"diagnosticsHistory"`
+}
+
+// writes the server's configuration, progress, diagnostics history and agents (in order of addition) to w.
+// Agents implementing agent.Snapshotter also have their internal state saved
+func (serv *BaseServer[T]) Snapshot(w io.Writer) error {
+	serv.idGeneratorLock.Lock()
+	snapshot := serverSnapshot{
+		Iterations:          serv.iterations,
+		Turns:               serv.turns,
+		TurnTimeout:         serv.turnTimeout,
+		MessageBandwidth:    serv.agentMessagingBandwidth,
+		CompletedIterations: serv.completedIterations,
+		StopReason:          serv.stopReason,
+		Deterministic:       serv.deterministic,
+		Seed:                serv.seed,
+		GeneratedIDs:        serv.generatedIDs,
+		GeneratedMessageIDs: serv.generatedMessageIDs,
+		Agents:              make([]agentSnapshot, 0, len(serv.agentOrder)),
+		DiagnosticsHistory:  serv.diagnosticsEngine.GetHistory(),
+	}
+	serv.idGeneratorLock.Unlock()
+	for _, id := range serv.agentOrder {
+		entry := agentSnapshot{ID: id}
+		if snapshotter, ok := any(serv.agentMap[id]).(agent.Snapshotter); ok {
+			state, err := snapshotter.SnapshotState()
+			if err != nil {
+				return fmt.Errorf("snapshot of agent %s failed: %w", id, err)
+			}
+			entry.State = state
+		}
+		snapshot.Agents = append(snapshot.Agents, entry)
+	}
+	return json.NewEncoder(w).Encode(snapshot)
+}
+
+// replaces the server's configuration, progress, diagnostics history and agents with those read from a snapshot.
+// The factory is called once per saved agent, in order, and must create the agent through
+// agent.CreateBaseAgent so that it is assigned its saved ID. Every agent is recreated before the
+// server is changed, so a failed restore leaves it as it was. A subsequent Start resumes
+// from the iteration after the last one completed
+func (serv *BaseServer[T]) Restore(r io.Reader, agentFactory func() T) error {
+	var snapshot serverSnapshot
+	if err := json.NewDecoder(r).Decode(&snapshot); err != nil {
+		return fmt.Errorf("unable to decode server snapshot: %w", err)
+	}
+	restoredAgents, err := serv.restoreAgents(snapshot.Agents, agentFactory)
+	if err != nil {
+		return err
+	}
+
+	serv.iterations = snapshot.Iterations
+	serv.turns = snapshot.Turns
+	serv.turnTimeout = snapshot.TurnTimeout
+	serv.agentMessagingBandwidth = snapshot.MessageBandwidth
+	serv.completedIterations = snapshot.CompletedIterations
+	serv.stopReason = snapshot.StopReason
+	serv.diagnosticsEngine.RestoreHistory(snapshot.DiagnosticsHistory)
+
+	serv.idGeneratorLock.Lock()
+	serv.deterministic = snapshot.Deterministic
+	serv.seedGenerators(snapshot.Seed)
+	if snapshot.Deterministic {
+		for serv.generatedIDs < snapshot.GeneratedIDs {
+			serv.nextSeededID()
+		}
+		for serv.generatedMessageIDs < snapshot.GeneratedMessageIDs {
+			serv.nextSeededMessageID()
+		}
+	}
+	serv.idGeneratorLock.Unlock()
+
+	for _, existing := range serv.agentMap {
+		serv.RemoveAgent(existing)
+	}
+	for _, restored := range restoredAgents {
+		serv.AddAgent(restored)
+	}
+	return nil
+}
+
+// recreates the saved agents with their saved IDs and state, without adding them to the server
+func (serv *BaseServer[T]) restoreAgents(entries []agentSnapshot, agentFactory func() T) ([]T, error) {
+	serv.idGeneratorLock.Lock()
+	serv.restoredIDs = make([]uuid.UUID, 0, len(entries))
+	for _, entry := range entries {
+		serv.restoredIDs = append(serv.restoredIDs, entry.ID)
+	}
+	serv.idGeneratorLock.Unlock()
+	// discard the IDs of agents not recreated, so they are not handed to new agents
+	defer func() {
+		serv.idGeneratorLock.Lock()
+		serv.restoredIDs = nil
+		serv.idGeneratorLock.Unlock()
+	}()
+
+	restoredAgents := make([]T, 0, len(entries))
+	for _, entry := range entries {
+		restored := agentFactory()
+		if restored.GetID() != entry.ID {
+			return nil, fmt.Errorf("restored agent has ID %s, expected %s - was it created with CreateBaseAgent?", restored.GetID(), entry.ID)
+		}
+		if entry.State != nil {
+			snapshotter, ok := any(restored).(agent.Snapshotter)
+			if !ok {
+				return nil, fmt.Errorf("agent %s has saved state but does not implement Snapshotter", entry.ID)
+			}
+			if err := snapshotter.RestoreState(entry.State); err != nil {
+				return nil, fmt.Errorf("restore of agent %s failed: %w", entry.ID, err)
+			}
+		}
+		restoredAgents = append(restoredAgents, restored)
+	}
+	return restoredAgents, nil
+}
+
+// registers a function supplying a destination for a snapshot taken at the end of every iteration.
+// The destination is closed once written; an error halts the run
+func (serv *BaseServer[T]) SetCheckpointWriter(checkpointWriter func(iteration int) (io.WriteCloser, error)) {
+	serv.checkpointWriter = checkpointWriter
+}
+
+func (serv *BaseServer[T]) writeCheckpoint(iteration int) error {
+	if serv.checkpointWriter == nil {
+		return nil
+	}
+	w, err := serv.checkpointWriter(iteration)
+	if err != nil {
+		return fmt.Errorf("unable to open checkpoint for iteration %d: %w", iteration, err)
+	}
+	if err := serv.Snapshot(w); err != nil {
+		w.Close()
+		return fmt.Errorf("unable to write checkpoint for iteration %d: %w", iteration, err)
+	}
+	return w.Close()
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/events"
+	"github.com/google/uuid"
+)
+
+// a condition under which a run, or the current iteration, ends early
+type StopCondition[T any] struct {
+	// recorded as the reason the run or iteration ended
+	Reason string
+	// checked against the server's agents after every turn and iteration; true ends the run
+	Predicate func(agentMap map[uuid.UUID]T) bool
+	// ends only the remaining turns of the current iteration, rather than the run
+	IterationOnly bool
+}
+
+// ends the run once every agent has been removed
+func NoAgentsRemain[T any]() StopCondition[T] {
+	return StopCondition[T]{
+		Reason: "no agents remain",
+		Predicate: func(agentMap map[uuid.UUID]T) bool {
+			return len(agentMap) == 0
+		},
+	}
+}
+
+// ends the run once every agent satisfies the predicate (e.g. all agents agree on a decision)
+func AllAgentsSatisfy[T any](reason string, predicate func(T) bool) StopCondition[T] {
+	return StopCondition[T]{
+		Reason: reason,
+		Predicate: func(agentMap map[uuid.UUID]T) bool {
+			for _, ag := range agentMap {
+				if !predicate(ag) {
+					return false
+				}
+			}
+			return true
+		},
+	}
+}
+
+// ends the run once any agent satisfies the predicate (e.g. an agent has depleted a resource)
+func AnyAgentSatisfies[T any](reason string, predicate func(T) bool) StopCondition[T] {
+	return StopCondition[T]{
+		Reason: reason,
+		Predicate: func(agentMap map[uuid.UUID]T) bool {
+			for _, ag := range agentMap {
+				if predicate(ag) {
+					return true
+				}
+			}
+			return false
+		},
+	}
+}
+
+// registers a condition checked after every turn and iteration. Several conditions may be registered;
+// the first satisfied, in order of registration, ends the run or iteration
+func (serv *BaseServer[T]) AddStopCondition(condition StopCondition[T]) {
+	serv.stopConditions = append(serv.stopConditions, condition)
+}
+
+// returns the reason the last run ended early ("" if it ran every iteration)
+func (serv *BaseServer[T]) GetStopReason() string {
+	return serv.stopReason
+}
+
+// checks the stop conditions, recording the reason if the run should end. Iteration-only
+// conditions are checked only after a turn. Returns the first condition satisfied (nil if none),
+// in which case the rest of the iteration should be skipped
+func (serv *BaseServer[T]) checkStopConditions(afterTurn bool) *StopCondition[T] {
+	for k, condition := range serv.stopConditions {
+		if condition.IterationOnly && !afterTurn {
+			continue
+		}
+		if !condition.Predicate(serv.agentMap) {
+			continue
+		}
+		if condition.IterationOnly {
+			serv.EmitEvent(events.Event{Type: events.IterationStopped, Detail: condition.Reason})
+		} else {
+			serv.stopReason = condition.Reason
+			serv.EmitEvent(events.Event{Type: events.RunStopped, Detail: condition.Reason})
+		}
+		return &serv.stopConditions[k]
+	}
+	return nil
+}
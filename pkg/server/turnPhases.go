@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/agent"
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/events"
+)
+
+// a named stage of a turn, ending in its own messaging session
+type TurnPhase[T any] struct {
+	Name string
+	// maximum duration of the phase's messaging session (0 to use the server's turn timeout)
+	Timeout time.Duration
+	// called once at the start of the phase (may be nil). An error halts the run once the
+	// phase's messaging session has ended, and is recorded in its result
+	Run func(iteration, turn int) error
+	// called for every agent after Run, in parallel if agent hooks are parallel (may be nil)
+	AgentAction func(agent T, iteration, turn int)
+}
+
+// splits each turn into the given phases, run in order. The phases replace the game runner's
+// RunTurn and are seen by runner middleware as a single RunTurn call; with no phases, each turn
+// is a single RunTurn followed by one messaging session
+func (serv *BaseServer[T]) SetTurnPhases(phases ...TurnPhase[T]) {
+	serv.turnPhases = phases
+}
+
+// runs each turn as the server's phases in place of the game runner's RunTurn
+type phasedGameRunner[T agent.IAgent[T]] struct {
+	FallibleGameRunner
+	serv *BaseServer[T]
+}
+
+func (pr *phasedGameRunner[T]) RunTurn(ctx context.Context, iteration, turn int) error {
+	return pr.serv.runTurnPhases(ctx, iteration, turn)
+}
+
+// runs every phase of the turn, assuming the first phase's messaging session is already open.
+// Each phase ends its messaging session, other than one interrupted by a panic
+func (serv *BaseServer[T]) runTurnPhases(ctx context.Context, iteration, turn int) error {
+	for k, phase := range serv.turnPhases {
+		if k > 0 {
+			if ctx.Err() != nil {
+				return &RunHaltedError{Iteration: iteration, Turn: turn, Cause: ctx.Err()}
+			}
+			serv.handleStartOfTurn()
+		}
+		serv.EmitEvent(events.Event{Type: events.PhaseStarted, Detail: phase.Name})
+		var err error
+		if phase.Run != nil {
+			err = phase.Run(iteration, turn)
+		}
+		if err == nil && phase.AgentAction != nil {
+			serv.invokeAgentHooks(func(ag T) {
+				phase.AgentAction(ag, iteration, turn)
+			})
+		}
+		timeout := phase.Timeout
+		if timeout == 0 {
+			timeout = serv.turnTimeout
+		}
+		serv.endMessagingSession(timeout)
+		if err != nil {
+			return fmt.Errorf("phase %q failed: %w", phase.Name, err)
+		}
+		serv.EmitEvent(events.Event{Type: events.PhaseEnded, Detail: phase.Name})
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package topology
+
+import (
+	"math/rand"
+
+	"github.com/google/uuid"
+)
+
+func createGraphWithNodes(ids []uuid.UUID) *Graph {
+	g := CreateGraph()
+	for _, id := range ids {
+		g.AddNode(id)
+	}
+	return g
+}
+
+// connects each agent to the next, and the last to the first
+func Ring(ids []uuid.UUID) *Graph {
+	g := createGraphWithNodes(ids)
+	if len(ids) < 2 {
+		return g
+	}
+	for i := range ids {
+		g.AddEdge(ids[i], ids[(i+1)%len(ids)])
+	}
+	return g
+}
+
+// lays agents out row by row in a grid of the given width, connecting each to the agents
+// above, below, left and right of it
+func Grid(ids []uuid.UUID, width int) *Graph {
+	if width <= 0 {
+		panic("Grid width must be positive")
+	}
+	g := createGraphWithNodes(ids)
+	for i := range ids {
+		if (i+1)%width != 0 && i+1 < len(ids) {
+			g.AddEdge(ids[i], ids[i+1])
+		}
+		if i+width < len(ids) {
+			g.AddEdge(ids[i], ids[i+width])
+		}
+	}
+	return g
+}
+
+// generates a Watts-Strogatz small-world graph: each agent is connected to its k nearest
+// neighbours on a ring (k/2 either side), then each edge is rewired to a random agent with probability beta
+func SmallWorld(ids []uuid.UUID, k int, beta float64, rng *rand.Rand) *Graph {
+	g := createGraphWithNodes(ids)
+	n := len(ids)
+	if n < 2 {
+		return g
+	}
+	for i := range ids {
+		for j := 1; j <= k/2; j++ {
+			g.AddEdge(ids[i], ids[(i+j)%n])
+		}
+	}
+	for i := range ids {
+		for j := 1; j <= k/2; j++ {
+			neighbour := ids[(i+j)%n]
+			if rng.Float64() >= beta || !g.AreNeighbours(ids[i], neighbour) {
+				continue
+			}
+			if g.Degree(ids[i]) >= n-1 {
+				continue
+			}
+			target := ids[rng.Intn(n)]
+			for target == ids[i] || g.AreNeighbours(ids[i], target) {
+				target = ids[rng.Intn(n)]
+			}
+			g.RemoveEdge(ids[i], neighbour)
+			g.AddEdge(ids[i], target)
+		}
+	}
+	return g
+}
+
+// generates a Barabasi-Albert scale-free graph: agents join one at a time, each connecting to m
+// existing agents chosen with probability proportional to their degree
+func ScaleFree(ids []uuid.UUID, m int, rng *rand.Rand) *Graph {
+	if m <= 0 {
+		panic("Scale-free attachment count must be positive")
+	}
+	g := createGraphWithNodes(ids)
+	if len(ids) <= m {
+		for i := range ids {
+			for j := i + 1; j < len(ids); j++ {
+				g.AddEdge(ids[i], ids[j])
+			}
+		}
+		return g
+	}
+	// each agent appears once per edge end, so uniform sampling is proportional to degree
+	endpoints := []uuid.UUID{}
+	for i := 0; i <= m; i++ {
+		for j := i + 1; j <= m; j++ {
+			g.AddEdge(ids[i], ids[j])
+			endpoints = append(endpoints, ids[i], ids[j])
+		}
+	}
+	for _, newcomer := range ids[m+1:] {
+		targets := make(map[uuid.UUID]struct{}, m)
+		ordered := make([]uuid.UUID, 0, m)
+		for len(ordered) < m {
+			target := endpoints[rng.Intn(len(endpoints))]
+			if _, chosen := targets[target]; chosen {
+				continue
+			}
+			targets[target] = struct{}{}
+			ordered = append(ordered, target)
+		}
+		for _, target := range ordered {
+			g.AddEdge(newcomer, target)
+			endpoints = append(endpoints, newcomer, target)
+		}
+	}
+	return g
+}
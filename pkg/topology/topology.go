@@ -0,0 +1,96 @@
+package topology
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// undirected communication graph between agents
+type Graph struct {
+	lock sync.RWMutex
+	// map of agentid -> neighbour IDs, in order of connection
+	adjacency map[uuid.UUID][]uuid.UUID
+}
+
+func CreateGraph() *Graph {
+	return &Graph{
+		adjacency: make(map[uuid.UUID][]uuid.UUID),
+	}
+}
+
+// adds an agent to the graph without connecting it to any other
+func (g *Graph) AddNode(id uuid.UUID) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if _, ok := g.adjacency[id]; !ok {
+		g.adjacency[id] = []uuid.UUID{}
+	}
+}
+
+// removes an agent and all of its connections from the graph
+func (g *Graph) RemoveNode(id uuid.UUID) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	for _, neighbour := range g.adjacency[id] {
+		g.adjacency[neighbour] = slices.DeleteFunc(g.adjacency[neighbour], func(n uuid.UUID) bool {
+			return n == id
+		})
+	}
+	delete(g.adjacency, id)
+}
+
+// connects two agents in both directions. Self-loops are ignored
+func (g *Graph) AddEdge(a, b uuid.UUID) {
+	if a == b {
+		return
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if slices.Contains(g.adjacency[a], b) {
+		return
+	}
+	g.adjacency[a] = append(g.adjacency[a], b)
+	g.adjacency[b] = append(g.adjacency[b], a)
+}
+
+func (g *Graph) RemoveEdge(a, b uuid.UUID) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.adjacency[a] = slices.DeleteFunc(g.adjacency[a], func(n uuid.UUID) bool {
+		return n == b
+	})
+	g.adjacency[b] = slices.DeleteFunc(g.adjacency[b], func(n uuid.UUID) bool {
+		return n == a
+	})
+}
+
+func (g *Graph) AreNeighbours(a, b uuid.UUID) bool {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	return slices.Contains(g.adjacency[a], b)
+}
+
+// returns an agent's neighbours, in order of connection
+func (g *Graph) Neighbours(id uuid.UUID) []uuid.UUID {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	return slices.Clone(g.adjacency[id])
+}
+
+func (g *Graph) Degree(id uuid.UUID) int {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	return len(g.adjacency[id])
+}
+
+func (g *Graph) NumberOfEdges() int {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	total := 0
+	for _, neighbours := range g.adjacency {
+		total += len(neighbours)
+	}
+	return total / 2
+}
@@ -0,0 +1,98 @@
+package topology_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/topology"
+	"github.com/google/uuid"
+)
+
+func generateIds(n int) []uuid.UUID {
+	ids := make([]uuid.UUID, n)
+	for i := range ids {
+		ids[i] = uuid.New()
+	}
+	return ids
+}
+
+func TestEdgesAreUndirected(t *testing.T) {
+	ids := generateIds(3)
+	g := topology.CreateGraph()
+	g.AddEdge(ids[0], ids[1])
+	g.AddEdge(ids[1], ids[0])
+	g.AddEdge(ids[2], ids[2])
+	if !g.AreNeighbours(ids[0], ids[1]) || !g.AreNeighbours(ids[1], ids[0]) {
+		t.Error("Edge not added in both directions")
+	}
+	if g.NumberOfEdges() != 1 {
+		t.Error("Expected 1 edge, got:", g.NumberOfEdges())
+	}
+	g.RemoveNode(ids[1])
+	if g.AreNeighbours(ids[0], ids[1]) || g.Degree(ids[0]) != 0 {
+		t.Error("Edges not removed with node")
+	}
+}
+
+func TestRing(t *testing.T) {
+	n := 6
+	ids := generateIds(n)
+	g := topology.Ring(ids)
+	for i, id := range ids {
+		if g.Degree(id) != 2 || !g.AreNeighbours(id, ids[(i+1)%n]) {
+			t.Error("Agent", i, "not connected to its ring neighbours")
+		}
+	}
+}
+
+func TestGrid(t *testing.T) {
+	ids := generateIds(6)
+	g := topology.Grid(ids, 3)
+	expectedDegrees := []int{2, 3, 2, 2, 3, 2}
+	for i, id := range ids {
+		if g.Degree(id) != expectedDegrees[i] {
+			t.Errorf("Agent %d has degree %d, expected %d", i, g.Degree(id), expectedDegrees[i])
+		}
+	}
+	if g.AreNeighbours(ids[2], ids[3]) {
+		t.Error("Grid wrapped between rows")
+	}
+}
+
+func TestSmallWorld(t *testing.T) {
+	n := 20
+	k := 4
+	ids := generateIds(n)
+	lattice := topology.SmallWorld(ids, k, 0, rand.New(rand.NewSource(1)))
+	for _, id := range ids {
+		if lattice.Degree(id) != k {
+			t.Error("Unrewired small-world graph is not a regular lattice")
+		}
+	}
+	rewired := topology.SmallWorld(ids, k, 0.5, rand.New(rand.NewSource(1)))
+	if rewired.NumberOfEdges() != n*k/2 {
+		t.Error("Rewiring changed the number of edges: got", rewired.NumberOfEdges(), "expected", n*k/2)
+	}
+	again := topology.SmallWorld(ids, k, 0.5, rand.New(rand.NewSource(1)))
+	for _, id := range ids {
+		if len(again.Neighbours(id)) != len(rewired.Neighbours(id)) {
+			t.Error("Small-world generation not reproducible for a fixed seed")
+		}
+	}
+}
+
+func TestScaleFree(t *testing.T) {
+	n := 50
+	m := 2
+	ids := generateIds(n)
+	g := topology.ScaleFree(ids, m, rand.New(rand.NewSource(1)))
+	expectedEdges := (m+1)*m/2 + (n-m-1)*m
+	if g.NumberOfEdges() != expectedEdges {
+		t.Error("Expected", expectedEdges, "edges, got:", g.NumberOfEdges())
+	}
+	for _, id := range ids {
+		if g.Degree(id) < m {
+			t.Error("Agent joined with fewer than", m, "connections")
+		}
+	}
+}
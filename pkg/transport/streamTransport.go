@@ -0,0 +1,296 @@
+package transport
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/message"
+	"github.com/google/uuid"
+)
+
+// largest frame accepted from a peer, guarding against corrupt or hostile length prefixes
+const MaxFrameSize = 16 << 20
+
+// kinds of frame exchanged between the two ends of a stream
+const (
+	frameMessage   = "message"
+	frameAgents    = "agents"
+	frameComplete  = "complete"
+	frameLifecycle = "lifecycle"
+)
+
+// stages of a run forwarded from a shared server to the processes running its remote agents
+const (
+	StageIterationStart = "iterationStart"
+	StageTurnStart      = "turnStart"
+	StageTurnEnd        = "turnEnd"
+	StageIterationEnd   = "iterationEnd"
+)
+
+// unit of data exchanged between the two ends of a stream
+type frame struct {
+	Kind string `json:"kind"`
+	// recipient of a message
+	Recipient uuid.UUID `json:"recipient"`
+	// message, as encoded by the codec
+	Payload []byte `json:"payload,omitempty"`
+	// agents announced by the sender, or the agent which finished messaging
+	Agents []uuid.UUID `json:"agents,omitempty"`
+	// lifecycle stage started by the sender
+	Stage     string `json:"stage,omitempty"`
+	Iteration int    `json:"iteration"`
+	Turn      int    `json:"turn"`
+}
+
+// receives what the peer process sends over a stream (implemented by the server's stream links)
+type StreamPeer[T any] interface {
+	// whether a message from the peer may be delivered to the agent
+	AcceptsRecipient(uuid.UUID) bool
+	// delivers a message from the peer to its recipient
+	DeliverMessage(message.IMessage[T], uuid.UUID)
+	// records agents announced by the peer as living in its process
+	AddRemoteAgents([]uuid.UUID)
+	// records that an agent in the peer process has finished messaging
+	RemoteAgentStoppedTalking(uuid.UUID)
+	// runs a stage of the run started by the peer
+	FollowLifecycle(stage string, iteration, turn int)
+}
+
+// delivers messages for remote agents over a byte stream (such as a socket) to a peer
+// process, and messages for all other agents through a local transport. Both processes
+// run a StreamTransport over the same connection, and call Serve to receive their peer's frames.
+// Besides messages, the stream carries announcements of the agents living in each process,
+// messaging complete signals and the stages of a shared run (see server.ServeRemoteAgents)
+type StreamTransport[T any] struct {
+	// connection to the peer process
+	conn io.ReadWriter
+	// serialises messages into frame payloads
+	codec MessageCodec[T]
+	// transport for agents living in this process
+	local Transport[T]
+	// hashset of agent IDs living in the peer process
+	remoteAgents map[uuid.UUID]struct{}
+	// guards the remote agent set
+	remoteLock sync.RWMutex
+	// serialises writes of frames to the connection
+	writeLock sync.Mutex
+	// called when a frame cannot be sent, or a received frame is rejected (may be nil)
+	onError func(error)
+}
+
+func CreateStreamTransport[T any](conn io.ReadWriter, codec MessageCodec[T], local Transport[T], onError func(error)) *StreamTransport[T] {
+	return &StreamTransport[T]{
+		conn:         conn,
+		codec:        codec,
+		local:        local,
+		remoteAgents: make(map[uuid.UUID]struct{}),
+		onError:      onError,
+	}
+}
+
+// marks agents as living in the peer process, so that messages to them are sent over the stream
+func (t *StreamTransport[T]) RegisterRemoteAgents(ids ...uuid.UUID) {
+	t.remoteLock.Lock()
+	defer t.remoteLock.Unlock()
+	for _, id := range ids {
+		t.remoteAgents[id] = struct{}{}
+	}
+}
+
+func (t *StreamTransport[T]) isRemote(id uuid.UUID) bool {
+	t.remoteLock.RLock()
+	defer t.remoteLock.RUnlock()
+	_, ok := t.remoteAgents[id]
+	return ok
+}
+
+func (t *StreamTransport[T]) Deliver(msg message.IMessage[T], recipient uuid.UUID) {
+	if !t.isRemote(recipient) {
+		t.local.Deliver(msg, recipient)
+		return
+	}
+	if err := t.send(msg, recipient); err != nil {
+		t.report(fmt.Errorf("unable to send message to remote agent %s: %w", recipient, err))
+	}
+}
+
+// tells the peer that the agents live in this process, so that it sends their messages over the stream
+func (t *StreamTransport[T]) AnnounceAgents(ids ...uuid.UUID) {
+	if err := t.writeFrame(frame{Kind: frameAgents, Agents: ids}); err != nil {
+		t.report(fmt.Errorf("unable to announce %d agents: %w", len(ids), err))
+	}
+}
+
+// tells the peer that an agent in this process has finished messaging
+func (t *StreamTransport[T]) SignalMessagingComplete(id uuid.UUID) {
+	if err := t.writeFrame(frame{Kind: frameComplete, Agents: []uuid.UUID{id}}); err != nil {
+		t.report(fmt.Errorf("unable to signal messaging complete for agent %s: %w", id, err))
+	}
+}
+
+// tells the peer that a stage of the run has started
+func (t *StreamTransport[T]) ForwardLifecycle(stage string, iteration, turn int) {
+	if err := t.writeFrame(frame{Kind: frameLifecycle, Stage: stage, Iteration: iteration, Turn: turn}); err != nil {
+		t.report(fmt.Errorf("unable to forward %s of iteration %d, turn %d: %w", stage, iteration, turn, err))
+	}
+}
+
+func (t *StreamTransport[T]) report(err error) {
+	if t.onError != nil {
+		t.onError(err)
+	}
+}
+
+func (t *StreamTransport[T]) send(msg message.IMessage[T], recipient uuid.UUID) error {
+	payload, err := t.codec.Encode(msg)
+	if err != nil {
+		return err
+	}
+	return t.writeFrame(frame{Kind: frameMessage, Recipient: recipient, Payload: payload})
+}
+
+func (t *StreamTransport[T]) writeFrame(f frame) error {
+	encodedFrame, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	if len(encodedFrame) > MaxFrameSize {
+		return fmt.Errorf("frame of %d bytes exceeds maximum of %d", len(encodedFrame), MaxFrameSize)
+	}
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, uint32(len(encodedFrame)))
+	t.writeLock.Lock()
+	defer t.writeLock.Unlock()
+	if _, err := t.conn.Write(header); err != nil {
+		return err
+	}
+	_, err = t.conn.Write(encodedFrame)
+	return err
+}
+
+func readFrame(reader io.Reader) (frame, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return frame{}, err
+	}
+	size := binary.BigEndian.Uint32(header)
+	if size > MaxFrameSize {
+		return frame{}, fmt.Errorf("frame of %d bytes exceeds maximum of %d", size, MaxFrameSize)
+	}
+	encodedFrame := make([]byte, size)
+	if _, err := io.ReadFull(reader, encodedFrame); err != nil {
+		return frame{}, err
+	}
+	var received frame
+	if err := json.Unmarshal(encodedFrame, &received); err != nil {
+		return frame{}, fmt.Errorf("unable to decode frame: %w", err)
+	}
+	return received, nil
+}
+
+// receives frames from the peer process and passes them to the local end, in order, until the
+// stream is closed (returning nil) or a frame cannot be read or decoded. Messages for agents which
+// the local end does not accept are rejected and reported. Frames are read on a separate
+// goroutine, so that handlers sending to the peer cannot deadlock with the peer doing the same;
+// after an error, the caller should close the connection to stop it
+func (t *StreamTransport[T]) Serve(peer StreamPeer[T]) error {
+	queue := createFrameQueue()
+	go func() {
+		reader := bufio.NewReader(t.conn)
+		for {
+			received, err := readFrame(reader)
+			queue.push(received, err)
+			if err != nil {
+				return
+			}
+		}
+	}()
+	for {
+		next, err := queue.pop()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if err := t.handle(peer, next); err != nil {
+			return err
+		}
+	}
+}
+
+func (t *StreamTransport[T]) handle(peer StreamPeer[T], received frame) error {
+	switch received.Kind {
+	case frameMessage:
+		msg, err := t.codec.Decode(received.Payload)
+		if err != nil {
+			return fmt.Errorf("unable to decode message for %s: %w", received.Recipient, err)
+		}
+		if t.isRemote(received.Recipient) || !peer.AcceptsRecipient(received.Recipient) {
+			t.report(fmt.Errorf("rejected message from peer for unknown agent %s", received.Recipient))
+			return nil
+		}
+		peer.DeliverMessage(msg, received.Recipient)
+	case frameAgents:
+		t.RegisterRemoteAgents(received.Agents...)
+		peer.AddRemoteAgents(received.Agents)
+	case frameComplete:
+		for _, id := range received.Agents {
+			if !t.isRemote(id) {
+				t.report(fmt.Errorf("rejected messaging complete signal from peer for unknown agent %s", id))
+				continue
+			}
+			peer.RemoteAgentStoppedTalking(id)
+		}
+	case frameLifecycle:
+		peer.FollowLifecycle(received.Stage, received.Iteration, received.Turn)
+	default:
+		return fmt.Errorf("unknown frame kind %q", received.Kind)
+	}
+	return nil
+}
+
+// unbounded FIFO of frames read from a stream, ending with the error which stopped reading
+type frameQueue struct {
+	lock    sync.Mutex
+	ready   *sync.Cond
+	pending []frame
+	err     error
+}
+
+func createFrameQueue() *frameQueue {
+	queue := &frameQueue{}
+	queue.ready = sync.NewCond(&queue.lock)
+	return queue
+}
+
+func (fq *frameQueue) push(received frame, err error) {
+	fq.lock.Lock()
+	defer fq.lock.Unlock()
+	if err != nil {
+		fq.err = err
+	} else {
+		fq.pending = append(fq.pending, received)
+	}
+	fq.ready.Signal()
+}
+
+// blocks until a frame is available, returning the read error once every frame has been popped
+func (fq *frameQueue) pop() (frame, error) {
+	fq.lock.Lock()
+	defer fq.lock.Unlock()
+	for len(fq.pending) == 0 && fq.err == nil {
+		fq.ready.Wait()
+	}
+	if len(fq.pending) == 0 {
+		return frame{}, fq.err
+	}
+	next := fq.pending[0]
+	fq.pending = fq.pending[1:]
+	return next, nil
+}
@@ -0,0 +1,36 @@
+package transport
+
+import (
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/message"
+	"github.com/google/uuid"
+)
+
+// carries messages from the server to their recipients
+type Transport[T any] interface {
+	// hands a message to the recipient's message handler
+	Deliver(message.IMessage[T], uuid.UUID)
+}
+
+// encodes messages for transport across a process boundary (satisfied by message.CodecRegistry)
+type MessageCodec[T any] interface {
+	// serialises a message, including enough information to recover its concrete type
+	Encode(message.IMessage[T]) ([]byte, error)
+	// recovers a message serialised by Encode
+	Decode([]byte) (message.IMessage[T], error)
+}
+
+// delivers messages by directly invoking handlers on agents in the same process
+type InMemoryTransport[T any] struct {
+	// looks up the agent with the given ID
+	lookupAgent func(uuid.UUID) T
+}
+
+func (t *InMemoryTransport[T]) Deliver(msg message.IMessage[T], recipient uuid.UUID) {
+	msg.InvokeMessageHandler(t.lookupAgent(recipient))
+}
+
+func CreateInMemoryTransport[T any](lookupAgent func(uuid.UUID) T) *InMemoryTransport[T] {
+	return &InMemoryTransport[T]{
+		lookupAgent: lookupAgent,
+	}
+}
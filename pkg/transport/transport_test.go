@@ -0,0 +1,278 @@
+package transport_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MattSScott/basePlatformSOMAS/v2/internal/testUtils"
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/message"
+	"github.com/MattSScott/basePlatformSOMAS/v2/pkg/transport"
+	"github.com/google/uuid"
+)
+
+func createTestCodec(t *testing.T) *message.CodecRegistry[testUtils.ITestBaseAgent] {
+	registry := message.CreateCodecRegistry[testUtils.ITestBaseAgent]()
+	if err := registry.Register("test", &testUtils.TestMessage{}); err != nil {
+		t.Fatal("Unable to register TestMessage:", err)
+	}
+	return registry
+}
+
+type recordingTransport struct {
+	recipients []uuid.UUID
+}
+
+func (rt *recordingTransport) Deliver(msg message.IMessage[testUtils.ITestBaseAgent], recipient uuid.UUID) {
+	rt.recipients = append(rt.recipients, recipient)
+}
+
+func TestInMemoryTransportDelivers(t *testing.T) {
+	server := testUtils.GenerateTestServer(2, 1, 1, time.Millisecond, 100)
+	memoryTransport := transport.CreateInMemoryTransport(server.AccessAgentByID)
+	sender := testUtils.NewTestAgent(server)
+	for id := range server.ViewAgentIdSet() {
+		memoryTransport.Deliver(sender.CreateTestMessage(), id)
+	}
+	for _, ag := range server.GetAgentMap() {
+		if ag.GetCounter() != 1 {
+			t.Error("Agent received", ag.GetCounter(), "messages, expected 1")
+		}
+	}
+}
+
+func TestServerDelegatesToTransport(t *testing.T) {
+	server := testUtils.GenerateTestServer(2, 1, 1, time.Millisecond, 100)
+	recorder := &recordingTransport{}
+	server.SetTransport(recorder)
+	sender := testUtils.NewTestAgent(server)
+	for id := range server.ViewAgentIdSet() {
+		sender.SendSynchronousMessage(sender.CreateTestMessage(), id)
+	}
+	if len(recorder.recipients) != 2 {
+		t.Error("Transport received", len(recorder.recipients), "deliveries, expected 2")
+	}
+	for _, ag := range server.GetAgentMap() {
+		if ag.GetCounter() != 0 {
+			t.Error("Message bypassed the injected transport")
+		}
+	}
+}
+
+// accepts messages for a fixed set of agents, recording everything received from the peer
+type recordingPeer struct {
+	lock      sync.Mutex
+	accepted  map[uuid.UUID]struct{}
+	delivered []uuid.UUID
+	announced []uuid.UUID
+	completed []uuid.UUID
+	stages    []string
+}
+
+func createRecordingPeer(accepted ...uuid.UUID) *recordingPeer {
+	peer := &recordingPeer{accepted: make(map[uuid.UUID]struct{})}
+	for _, id := range accepted {
+		peer.accepted[id] = struct{}{}
+	}
+	return peer
+}
+
+func (rp *recordingPeer) AcceptsRecipient(id uuid.UUID) bool {
+	_, ok := rp.accepted[id]
+	return ok
+}
+
+func (rp *recordingPeer) DeliverMessage(msg message.IMessage[testUtils.ITestBaseAgent], recipient uuid.UUID) {
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+	rp.delivered = append(rp.delivered, recipient)
+}
+
+func (rp *recordingPeer) AddRemoteAgents(ids []uuid.UUID) {
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+	rp.announced = append(rp.announced, ids...)
+}
+
+func (rp *recordingPeer) RemoteAgentStoppedTalking(id uuid.UUID) {
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+	rp.completed = append(rp.completed, id)
+}
+
+func (rp *recordingPeer) FollowLifecycle(stage string, iteration, turn int) {
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+	rp.stages = append(rp.stages, fmt.Sprintf("%s %d.%d", stage, iteration, turn))
+}
+
+func TestStreamTransportDeliversToRemoteAgents(t *testing.T) {
+	localServer := testUtils.GenerateTestServer(1, 1, 1, time.Millisecond, 100)
+	codec := createTestCodec(t)
+	localConn, remoteConn := net.Pipe()
+	var rejected []error
+	localTransport := transport.CreateStreamTransport(localConn, codec, transport.CreateInMemoryTransport(localServer.AccessAgentByID), nil)
+	remoteTransport := transport.CreateStreamTransport(remoteConn, codec, nil, func(err error) {
+		rejected = append(rejected, err)
+	})
+	localServer.SetTransport(localTransport)
+	remoteID, unknownID := uuid.New(), uuid.New()
+	localTransport.RegisterRemoteAgents(remoteID, unknownID)
+	peer := createRecordingPeer(remoteID)
+
+	served := make(chan error)
+	go func() {
+		served <- remoteTransport.Serve(peer)
+	}()
+
+	localAgent := localServer.AccessAgentByID(localServer.ViewOrderedAgentIds()[0])
+	localAgent.SendSynchronousMessage(localAgent.CreateTestMessage(), remoteID)
+	localAgent.SendSynchronousMessage(localAgent.CreateTestMessage(), unknownID)
+	localAgent.SendSynchronousMessage(localAgent.CreateTestMessage(), localAgent.GetID())
+	localTransport.AnnounceAgents(localAgent.GetID())
+	localTransport.SignalMessagingComplete(localAgent.GetID())
+	localTransport.ForwardLifecycle(transport.StageTurnStart, 2, 3)
+	localConn.Close()
+	if err := <-served; err != nil {
+		t.Error("Serve returned error on closed stream:", err)
+	}
+	if len(peer.delivered) != 1 || peer.delivered[0] != remoteID {
+		t.Error("Expected one delivery to the remote agent, got:", peer.delivered)
+	}
+	if len(rejected) != 1 {
+		t.Error("Expected message for unknown agent to be rejected, got:", rejected)
+	}
+	if localAgent.GetCounter() != 1 {
+		t.Error("Local agent received", localAgent.GetCounter(), "messages, expected 1")
+	}
+	if len(peer.announced) != 1 || len(peer.completed) != 1 || len(peer.stages) != 1 || peer.stages[0] != "turnStart 2.3" {
+		t.Errorf("Unexpected frames received: %v announced, %v completed, stages %v", peer.announced, peer.completed, peer.stages)
+	}
+}
+
+func TestStreamTransportRejectsOversizedFrames(t *testing.T) {
+	codec := createTestCodec(t)
+	conn, peerConn := net.Pipe()
+	streamTransport := transport.CreateStreamTransport(conn, codec, nil, nil)
+	served := make(chan error)
+	go func() {
+		served <- streamTransport.Serve(createRecordingPeer())
+	}()
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, transport.MaxFrameSize+1)
+	peerConn.Write(header)
+	if err := <-served; err == nil {
+		t.Error("Oversized frame accepted")
+	}
+	peerConn.Close()
+}
+
+// broadcasts at the start of each turn, from a process joined to a shared server
+type broadcastingHookAgent struct {
+	*testUtils.TestHookAgent
+}
+
+func (ba *broadcastingHookAgent) OnTurnStart(iteration, turn int) {
+	ba.TestHookAgent.OnTurnStart(iteration, turn)
+	ba.BroadcastMessage(ba.CreateTestMessage())
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSharedServerRunsRemoteAgents(t *testing.T) {
+	sharedServer := testUtils.GenerateTestServer(2, 1, 1, time.Second, 100)
+	sharedServer.SetGameRunner(sharedServer)
+	agentServer := testUtils.GenerateTestServer(0, 1, 1, time.Second, 100)
+	remoteAgent := &broadcastingHookAgent{testUtils.NewTestHookAgent(agentServer)}
+	agentServer.AddAgent(remoteAgent)
+	// every agent hears from the other two, then signals messaging complete
+	remoteAgent.SetGoal(2)
+	for _, ag := range sharedServer.GetAgentMap() {
+		ag.SetGoal(2)
+	}
+
+	codec := createTestCodec(t)
+	if err := codec.Register("request", &testUtils.TestRequestMessage{}); err != nil {
+		t.Fatal("Unable to register TestRequestMessage:", err)
+	}
+	sharedConn, agentConn := net.Pipe()
+	sharedStream := transport.CreateStreamTransport(sharedConn, codec, nil, nil)
+	agentStream := transport.CreateStreamTransport(agentConn, codec, nil, nil)
+	served, joined := make(chan error), make(chan error)
+	go func() {
+		served <- sharedServer.ServeRemoteAgents(sharedStream)
+	}()
+	go func() {
+		joined <- agentServer.JoinSharedServer(agentStream)
+	}()
+	localIDs := sharedServer.ViewOrderedAgentIds()
+	waitFor(t, func() bool {
+		return len(sharedServer.ViewNeighbours(localIDs[0])) == 3 && len(agentServer.ViewNeighbours(remoteAgent.GetID())) == 3
+	})
+
+	result := sharedServer.Start()
+	if !result.Turns[0].MessagingComplete || result.Turns[0].AgentsFinishedMessaging != 3 {
+		t.Errorf("Expected local and remote agents to finish messaging, got %+v", result.Turns[0])
+	}
+	for _, id := range localIDs {
+		if !sharedServer.AccessAgentByID(id).ReceivedMessage() {
+			t.Error("Local agent did not receive messages from local and remote agents")
+		}
+	}
+	if !remoteAgent.ReceivedMessage() {
+		t.Error("Remote agent received", remoteAgent.GetCounter(), "messages, expected 2")
+	}
+	waitFor(t, func() bool {
+		return len(remoteAgent.Calls()) == 5
+	})
+	expectedCalls := []string{"added", "iterationStart 0", "turnStart 0.0", "turnEnd 0.0", "iterationEnd 0"}
+	for i, call := range remoteAgent.Calls() {
+		if call != expectedCalls[i] {
+			t.Errorf("Expected remote hook %q at position %d, got %q", expectedCalls[i], i, call)
+		}
+	}
+
+	requester := sharedServer.AccessAgentByID(localIDs[0])
+	reply := requester.Request(&testUtils.TestRequestMessage{BaseMessage: requester.CreateBaseMessage()}, remoteAgent.GetID(), time.Second)
+	if _, ok := <-reply; !ok {
+		t.Error("Reply from remote agent did not resolve the request")
+	}
+
+	agentConn.Close()
+	if err := <-served; err != nil {
+		t.Error("Shared server returned error on closed stream:", err)
+	}
+	<-joined
+	if neighbours := sharedServer.ViewNeighbours(localIDs[0]); len(neighbours) != 2 {
+		t.Error("Remote agent not dropped after disconnecting, neighbours:", neighbours)
+	}
+}
+
+func TestStreamTransportReportsSendErrors(t *testing.T) {
+	server := testUtils.GenerateTestServer(1, 1, 1, time.Millisecond, 100)
+	codec := createTestCodec(t)
+	conn, _ := net.Pipe()
+	conn.Close()
+	var reported error
+	streamTransport := transport.CreateStreamTransport(conn, codec, transport.CreateInMemoryTransport(server.AccessAgentByID), func(err error) {
+		reported = err
+	})
+	remoteID := uuid.New()
+	streamTransport.RegisterRemoteAgents(remoteID)
+	streamTransport.Deliver(testUtils.NewTestMessage(), remoteID)
+	if reported == nil {
+		t.Error("Write to closed stream not reported")
+	}
+}